@@ -0,0 +1,475 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	mimeJSONLines = "application/jsonl"
+	mimeZip       = "application/zip"
+
+	exportBatchSize = 100
+	maxImportSize   = 64 << 20
+)
+
+// archivedPost is a post as it appears in an export. In zip archives the
+// content is the Markdown body and everything else is YAML front matter.
+type archivedPost struct {
+	Slug        string     `json:"slug" yaml:"slug"`
+	Title       string     `json:"title" yaml:"title"`
+	Status      string     `json:"status" yaml:"status"`
+	Author      string     `json:"author,omitempty" yaml:"author,omitempty"`
+	Tags        []string   `json:"tags" yaml:"tags"`
+	CreatedAt   time.Time  `json:"created_at" yaml:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" yaml:"updated_at"`
+	PublishAt   *time.Time `json:"publish_at,omitempty" yaml:"publish_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty" yaml:"published_at,omitempty"`
+	Content     string     `json:"content" yaml:"-"`
+}
+
+// importResult reports what happened to one record of an import.
+type importResult struct {
+	Record string       `json:"record"`
+	Slug   string       `json:"slug,omitempty"`
+	Action string       `json:"action"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	DryRun    bool           `json:"dry_run"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Failed    int            `json:"failed"`
+	Results   []importResult `json:"results"`
+}
+
+// errDryRun rolls back the transaction of a record that was only checked.
+var errDryRun = errors.New("dry run")
+
+func marshalFrontMatter(post *archivedPost) ([]byte, error) {
+	meta, err := yaml.Marshal(post)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(meta)
+	buf.WriteString("---\n\n")
+	buf.WriteString(post.Content)
+	return buf.Bytes(), nil
+}
+
+func unmarshalFrontMatter(data []byte) (*archivedPost, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return nil, errors.New("missing front matter")
+	}
+	meta, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		return nil, errors.New("front matter is not closed")
+	}
+
+	post := new(archivedPost)
+	if err := yaml.Unmarshal([]byte(meta), post); err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+	post.Content = strings.TrimPrefix(body, "\n")
+	return post, nil
+}
+
+func (h *Handler) exportPosts(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "zip" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid format, must be jsonl or zip")
+	}
+
+	var authors []User
+	if err := h.DB.Select("id", "username").Find(&authors).Error; err != nil {
+		c.Logger().Errorf("Database error loading authors for export: %v", err)
+		return dbError(err, "Failed to export posts")
+	}
+	usernames := make(map[uint]string, len(authors))
+	for _, u := range authors {
+		usernames[u.ID] = u.Username
+	}
+
+	filename := "posts-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	// From here on the response is streaming, so errors can only be logged.
+	var write func(*archivedPost) error
+	var finish func() error
+	switch format {
+	case "jsonl":
+		res.Header().Set(echo.HeaderContentType, mimeJSONLines)
+		res.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(res)
+		write = func(post *archivedPost) error {
+			if err := enc.Encode(post); err != nil {
+				return err
+			}
+			res.Flush()
+			return nil
+		}
+		finish = func() error { return nil }
+	case "zip":
+		res.Header().Set(echo.HeaderContentType, mimeZip)
+		res.WriteHeader(http.StatusOK)
+		zw := zip.NewWriter(res)
+		write = func(post *archivedPost) error {
+			data, err := marshalFrontMatter(post)
+			if err != nil {
+				return err
+			}
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: post.Slug + ".md", Method: zip.Deflate, Modified: post.UpdatedAt})
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}
+		finish = zw.Close
+	}
+
+	var posts []Post
+	err := h.DB.Preload("Tags").Order("id").FindInBatches(&posts, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range posts {
+			post := &posts[i]
+			tags := make([]string, len(post.Tags))
+			for j, tag := range post.Tags {
+				tags[j] = tag.Name
+			}
+			record := &archivedPost{
+				Slug:        post.Slug,
+				Title:       post.Title,
+				Status:      post.Status,
+				Author:      usernames[post.AuthorID],
+				Tags:        tags,
+				CreatedAt:   post.CreatedAt.UTC(),
+				UpdatedAt:   post.UpdatedAt.UTC(),
+				PublishAt:   utcTime(post.PublishAt),
+				PublishedAt: utcTime(post.PublishedAt),
+				Content:     post.Content,
+			}
+			if err := write(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		c.Logger().Errorf("Error exporting posts: %v", err)
+	}
+	return nil
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// importRecord is one post read from an import, or the reason it couldn't
+// be read. JSON Lines records are named by line number, zip records by file.
+type importRecord struct {
+	Name string
+	Post *archivedPost
+	Err  error
+}
+
+func readImport(c echo.Context) ([]importRecord, error) {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxImportSize)
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Import is too large")
+		}
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+
+	var records []importRecord
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	switch contentType {
+	case mimeJSONLines, "application/x-ndjson":
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(nil, maxImportSize)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			post := new(archivedPost)
+			dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(post); err != nil {
+				records = append(records, importRecord{Name: "line " + strconv.Itoa(line), Err: echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON: "+err.Error())})
+				continue
+			}
+			records = append(records, importRecord{Name: "line " + strconv.Itoa(line), Post: post})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Failed to read JSON Lines body")
+		}
+	case mimeZip:
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid zip archive")
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || path.Ext(f.Name) != ".md" {
+				continue
+			}
+			// Entries never touch the disk, but a name escaping the archive
+			// means it wasn't made by an export, so it isn't trusted.
+			if !fs.ValidPath(f.Name) || strings.Contains(f.Name, `\`) {
+				records = append(records, importRecord{Name: f.Name, Err: echo.NewHTTPError(http.StatusBadRequest, "Invalid file name")})
+				continue
+			}
+			post, err := readArchiveFile(f)
+			if err != nil {
+				err = echo.NewHTTPError(http.StatusBadRequest, "Invalid file: "+err.Error())
+			}
+			records = append(records, importRecord{Name: f.Name, Post: post, Err: err})
+		}
+	default:
+		return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be "+mimeJSONLines+" or "+mimeZip)
+	}
+	return records, nil
+}
+
+func readArchiveFile(f *zip.File) (*archivedPost, error) {
+	if f.UncompressedSize64 > maxImportSize {
+		return nil, errors.New("file is too large")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxImportSize))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalFrontMatter(data)
+}
+
+func (h *Handler) importPosts(c echo.Context) error {
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+
+	records, err := readImport(c)
+	if err != nil {
+		return err
+	}
+
+	var users []User
+	if err := h.DB.Select("id", "username").Find(&users).Error; err != nil {
+		c.Logger().Errorf("Database error loading authors for import: %v", err)
+		return dbError(err, "Failed to import posts")
+	}
+	authors := make(map[string]uint, len(users))
+	for _, u := range users {
+		authors[u.Username] = u.ID
+	}
+
+	report := importReport{DryRun: dryRun, Results: make([]importResult, 0, len(records))}
+	for _, record := range records {
+		result := importResult{Record: record.Name}
+		err := record.Err
+		if err == nil {
+			result.Action, err = h.importPost(record.Post, authors, currentUser(c), dryRun)
+			result.Slug = record.Post.Slug
+		}
+
+		switch {
+		case err != nil:
+			p := toProblem(err)
+			if p.Status >= http.StatusInternalServerError {
+				c.Logger().Errorf("Error importing %s: %v", record.Name, err)
+			}
+			result.Action, result.Error, result.Errors = "failed", p.Detail, p.Errors
+			report.Failed++
+		case result.Action == "created":
+			report.Created++
+		case result.Action == "unchanged":
+			report.Unchanged++
+		default:
+			report.Updated++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// importPost creates or updates the post with the record's slug in its own
+// transaction, so one bad record doesn't stop the rest. A dry run does the
+// same work and rolls it back.
+func (h *Handler) importPost(record *archivedPost, authors map[string]uint, importer *authUser, dryRun bool) (string, error) {
+	if strings.TrimSpace(record.Slug) == "" {
+		record.Slug = record.Title
+	}
+	record.Slug = makeSlug(record.Slug)
+	if record.Status == "" {
+		record.Status = StatusDraft
+	}
+
+	tags := make([]Tag, len(record.Tags))
+	for i, name := range record.Tags {
+		tags[i].Name = name
+	}
+	names, err := normalizeTags(tags)
+	if err != nil {
+		return "", err
+	}
+
+	authorID, ok := authors[record.Author]
+	if !ok {
+		authorID = importer.ID
+	}
+
+	action := "updated"
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var existing Post
+		err := tx.Unscoped().Preload("Tags").Where("slug = ?", record.Slug).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			action = "created"
+			if err := createImportedPost(tx, record, names, authorID, importer); err != nil {
+				return err
+			}
+			if dryRun {
+				return errDryRun
+			}
+			return nil
+		}
+		if err != nil {
+			return dbError(err, "Failed to look up post")
+		}
+		if existing.DeletedAt.Valid {
+			return echo.NewHTTPError(http.StatusConflict, "Slug belongs to a post in the trash")
+		}
+
+		if importUnchanged(&existing, record, names) {
+			action = "unchanged"
+			return nil
+		}
+
+		before := existing
+		post := existing
+		post.Title, post.Content, post.Status = record.Title, record.Content, record.Status
+		post.PublishAt = record.PublishAt
+		if record.PublishedAt != nil {
+			post.PublishedAt = record.PublishedAt
+		}
+		if err := validatePost(&post); err != nil {
+			return err
+		}
+		if err := authorizeStatus(importer, &before, &post); err != nil {
+			return err
+		}
+		if err := saveUpdatedPost(tx, &before, &post, names, importer.ID); err != nil {
+			return dbError(err, "Failed to update post")
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return action, err
+}
+
+func importUnchanged(post *Post, record *archivedPost, tagNames []string) bool {
+	if post.Title != record.Title || post.Content != record.Content || post.Status != record.Status {
+		return false
+	}
+	if (post.PublishAt == nil) != (record.PublishAt == nil) || post.PublishAt != nil && !post.PublishAt.Equal(*record.PublishAt) {
+		return false
+	}
+	current := make([]string, len(post.Tags))
+	for i, tag := range post.Tags {
+		current[i] = tag.Name
+	}
+	slices.Sort(current)
+	return slices.Equal(current, slices.Sorted(slices.Values(tagNames)))
+}
+
+func createImportedPost(tx *gorm.DB, record *archivedPost, names []string, authorID uint, importer *authUser) error {
+	post := &Post{
+		Title:       record.Title,
+		Slug:        record.Slug,
+		Content:     record.Content,
+		Status:      record.Status,
+		PublishAt:   record.PublishAt,
+		PublishedAt: record.PublishedAt,
+		AuthorID:    authorID,
+		Version:     1,
+	}
+	if !record.CreatedAt.IsZero() {
+		post.CreatedAt = record.CreatedAt.Local()
+	}
+	if err := validatePost(post); err != nil {
+		return err
+	}
+	if err := authorizeStatus(importer, nil, post); err != nil {
+		return err
+	}
+	if err := renderPost(post); err != nil {
+		return err
+	}
+
+	tags, err := resolveTags(tx, names)
+	if err != nil {
+		return dbError(err, "Failed to create post")
+	}
+	post.Tags = tags
+	if err := assignSlug(tx, post); err != nil {
+		return dbError(err, "Failed to create post")
+	}
+	if post.Slug != record.Slug {
+		return echo.NewHTTPError(http.StatusConflict, "Slug is still redirecting to another post")
+	}
+	if err := tx.Create(post).Error; err != nil {
+		return dbError(err, "Failed to create post")
+	}
+	if err := recordRevision(tx, nil, post, importer.ID); err != nil {
+		return dbError(err, "Failed to create post")
+	}
+	if err := enqueuePostEvents(tx, nil, post); err != nil {
+		return dbError(err, "Failed to create post")
+	}
+	return nil
+}
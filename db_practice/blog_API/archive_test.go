@@ -0,0 +1,162 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportRecords exports all posts as JSON Lines and decodes them.
+func (s *testServer) exportRecords(t *testing.T, admin string) []archivedPost {
+	t.Helper()
+	rec := s.do(http.MethodGet, "/admin/export?format=jsonl", admin, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export = %d %s", rec.Code, rec.Body)
+	}
+	var records []archivedPost
+	for _, line := range bytes.Split(bytes.TrimSpace(rec.Body.Bytes()), []byte("\n")) {
+		var record archivedPost
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("decoding %s: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func (s *testServer) importArchive(t *testing.T, admin, query, contentType string, body []byte) importReport {
+	t.Helper()
+	rec := s.do(http.MethodPost, "/admin/import"+query, admin, string(body), echo.HeaderContentType, contentType)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body)
+	}
+	return decodeJSON[importReport](t, rec)
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sameRecords compares what an import carries over; update times are set
+// by the importing server.
+func sameRecords(a, b []archivedPost) bool {
+	return slices.EqualFunc(a, b, func(x, y archivedPost) bool {
+		return x.Slug == y.Slug && x.Title == y.Title && x.Status == y.Status && x.Author == y.Author &&
+			x.Content == y.Content && slices.Equal(x.Tags, y.Tags) && x.CreatedAt.Equal(y.CreatedAt)
+	})
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := newTestServer(t)
+	author := src.login(t, "writer", RoleAuthor)
+	src.createPost(t, author, map[string]any{"title": "First", "content": "# One\n\nBody", "tags": []string{"go"}})
+	src.createPost(t, author, map[string]any{"title": "Second", "content": "Two", "status": StatusDraft})
+	want := src.exportRecords(t, src.login(t, "root", RoleAdmin))
+
+	for _, format := range []string{"jsonl", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			rec := src.do(http.MethodGet, "/admin/export?format="+format, src.login(t, "admin-"+format, RoleAdmin), nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("export = %d %s", rec.Code, rec.Body)
+			}
+
+			dst := newTestServer(t)
+			dst.login(t, "writer", RoleAuthor)
+			admin := dst.login(t, "root", RoleAdmin)
+			report := dst.importArchive(t, admin, "", rec.Header().Get(echo.HeaderContentType), rec.Body.Bytes())
+			if report.Created != 2 || report.Failed != 0 {
+				t.Fatalf("import report %+v", report)
+			}
+			if got := dst.exportRecords(t, admin); !sameRecords(got, want) {
+				t.Errorf("round trip gave %+v, want %+v", got, want)
+			}
+
+			report = dst.importArchive(t, admin, "", rec.Header().Get(echo.HeaderContentType), rec.Body.Bytes())
+			if report.Unchanged != 2 {
+				t.Errorf("importing again = %+v, want both unchanged", report)
+			}
+		})
+	}
+}
+
+func TestImportUpsertAndDryRun(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleAuthor)
+	admin := s.login(t, "root", RoleAdmin)
+	post := s.createPost(t, author, map[string]any{"title": "Kept", "content": "Old"})
+	body := []byte(`{"slug": "kept", "title": "Kept", "status": "published", "tags": [], "content": "New"}
+{"slug": "fresh", "title": "Fresh", "status": "draft", "tags": ["go"], "content": "Brand new"}
+`)
+
+	report := s.importArchive(t, admin, "?dry_run=true", mimeJSONLines, body)
+	if !report.DryRun || report.Created != 1 || report.Updated != 1 {
+		t.Errorf("dry run report %+v", report)
+	}
+	var count int64
+	s.DB.Model(&Post{}).Count(&count)
+	var revisions int64
+	s.DB.Model(&PostRevision{}).Count(&revisions)
+	if current := s.exportRecords(t, admin); count != 1 || revisions != 1 || current[0].Content != "Old" {
+		t.Errorf("dry run wrote: %d posts, %d revisions, %+v", count, revisions, current)
+	}
+
+	report = s.importArchive(t, admin, "", mimeJSONLines, body)
+	if report.DryRun || report.Created != 1 || report.Updated != 1 {
+		t.Errorf("import report %+v", report)
+	}
+	var updated Post
+	if err := s.DB.Where("slug = ?", "kept").First(&updated).Error; err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != post.ID || updated.Content != "New" || updated.Version != 2 {
+		t.Errorf("post with the imported slug = %+v, want post %d updated in place", updated, post.ID)
+	}
+}
+
+func TestImportRejectsBadFiles(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login(t, "root", RoleAdmin)
+	good := "---\nslug: good\ntitle: Good\nstatus: published\n---\n\nBody\n"
+
+	report := s.importArchive(t, admin, "", mimeZip, zipArchive(t, map[string]string{
+		"good.md":         good,
+		"../escape.md":    good,
+		"/absolute.md":    good,
+		`dir\windows.md`:  good,
+		"no-header.md":    "title: Missing\n\nBody\n",
+		"unclosed.md":     "---\ntitle: Unclosed\n\nBody\n",
+		"invalid-yaml.md": "---\ntitle: [unbalanced\n---\n\nBody\n",
+		"notes.txt":       "ignored",
+	}))
+
+	if report.Created != 1 || report.Failed != 6 || len(report.Results) != 7 {
+		t.Fatalf("import report %+v", report)
+	}
+	for _, result := range report.Results {
+		if (result.Action == "failed") == (result.Record == "good.md") {
+			t.Errorf("%s: %s %s", result.Record, result.Action, result.Error)
+		}
+	}
+	var count int64
+	if s.DB.Model(&Post{}).Count(&count); count != 1 {
+		t.Errorf("%d posts after the import, want 1", count)
+	}
+}
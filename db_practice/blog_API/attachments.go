@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+)
+
+const (
+	thumbnailSize   = 320
+	maxImagePixels  = 50_000_000
+	maxFilenameSize = 255
+
+	// attachmentMaxAge bounds how long shared caches serve a public file
+	// after its post is unpublished or deleted.
+	attachmentMaxAge = 5 * time.Minute
+)
+
+// allowedUploads maps the sniffed MIME types we accept to their file extension.
+var allowedUploads = map[string]string{
+	"image/jpeg":                ".jpg",
+	"image/png":                 ".png",
+	"image/gif":                 ".gif",
+	"image/webp":                ".webp",
+	"application/pdf":           ".pdf",
+	"text/plain; charset=utf-8": ".txt",
+}
+
+type Attachment struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	PostID               uint      `json:"post_id" gorm:"not null;index"`
+	UploaderID           uint      `json:"uploader_id"`
+	Filename             string    `json:"filename" gorm:"not null"`
+	ContentType          string    `json:"content_type" gorm:"not null"`
+	Size                 int64     `json:"size"`
+	Width                int       `json:"width,omitempty"`
+	Height               int       `json:"height,omitempty"`
+	StorageKey           string    `json:"-" gorm:"not null"`
+	ThumbnailKey         string    `json:"-"`
+	ThumbnailContentType string    `json:"-"`
+	CreatedAt            time.Time `json:"created_at"`
+	URL                  string    `json:"url" gorm:"-"`
+	ThumbnailURL         string    `json:"thumbnail_url,omitempty" gorm:"-"`
+}
+
+func (h *Handler) withURLs(a *Attachment) *Attachment {
+	a.URL = h.Config.BaseURL + "/attachments/" + strconv.FormatUint(uint64(a.ID), 10)
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+	return a
+}
+
+func newStorageKey(ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(b)
+	return "attachments/" + name[:2] + "/" + name + ext, nil
+}
+
+// makeThumbnail scales img down to fit thumbnailSize and encodes it as PNG for
+// formats that may carry transparency, JPEG otherwise.
+func makeThumbnail(img image.Image, contentType string) ([]byte, string, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			w, h = thumbnailSize, max(1, h*thumbnailSize/w)
+		} else {
+			w, h = max(1, w*thumbnailSize/h), thumbnailSize
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(thumb, thumb.Bounds(), img, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if contentType == "image/png" || contentType == "image/gif" {
+		err := png.Encode(&buf, thumb)
+		return buf.Bytes(), "image/png", err
+	}
+	err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	return buf.Bytes(), "image/jpeg", err
+}
+
+func (h *Handler) deleteAttachmentFiles(ctx context.Context, a *Attachment) {
+	for _, key := range []string{a.StorageKey, a.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete attachment file %s: %v", key, err)
+		}
+	}
+}
+
+// removeOrphanedAttachments deletes attachments whose post has been purged.
+func (h *Handler) removeOrphanedAttachments(ctx context.Context) (int, error) {
+	var orphans []Attachment
+	err := h.DB.WithContext(ctx).Where("post_id NOT IN (SELECT id FROM posts)").Find(&orphans).Error
+	if err != nil {
+		return 0, err
+	}
+	for i := range orphans {
+		if err := h.DB.WithContext(ctx).Delete(&orphans[i]).Error; err != nil {
+			return i, err
+		}
+		h.deleteAttachmentFiles(ctx, &orphans[i])
+	}
+	return len(orphans), nil
+}
+
+func (h *Handler) uploadAttachment(c echo.Context) error {
+	post, err := h.findEditablePost(c)
+	if post == nil {
+		return err
+	}
+
+	// Leave some room for the multipart framing around the file itself.
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.Config.MaxUploadSize+1<<20)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "File is too large")
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing multipart file field \"file\"")
+	}
+	if fh.Size > h.Config.MaxUploadSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "File is too large")
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read uploaded file")
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read uploaded file")
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := allowedUploads[contentType]
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported file type "+contentType)
+	}
+
+	filename := filepath.Base(filepath.Clean("/" + fh.Filename))
+	if len(filename) > maxFilenameSize || filename == "/" {
+		filename = "upload" + ext
+	}
+	attachment := &Attachment{
+		PostID:      post.ID,
+		UploaderID:  currentUser(c).ID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        fh.Size,
+	}
+
+	ctx := c.Request().Context()
+	var thumbnail []byte
+	if contentType != "application/pdf" && contentType != "text/plain; charset=utf-8" {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to read uploaded file")
+		}
+		cfg, _, err := image.DecodeConfig(file)
+		if err != nil || cfg.Width*cfg.Height > maxImagePixels {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid or oversized image")
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to read uploaded file")
+		}
+		img, _, err := image.Decode(file)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid or oversized image")
+		}
+		attachment.Width, attachment.Height = cfg.Width, cfg.Height
+		thumbnail, attachment.ThumbnailContentType, err = makeThumbnail(img, contentType)
+		if err != nil {
+			c.Logger().Errorf("Error generating thumbnail: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store attachment")
+		}
+	}
+
+	if attachment.StorageKey, err = newStorageKey(ext); err != nil {
+		c.Logger().Errorf("Error generating storage key: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store attachment")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read uploaded file")
+	}
+	if err := h.Storage.Put(ctx, attachment.StorageKey, file); err != nil {
+		c.Logger().Errorf("Error storing attachment: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store attachment")
+	}
+	if thumbnail != nil {
+		attachment.ThumbnailKey = attachment.StorageKey + ".thumb"
+		if err := h.Storage.Put(ctx, attachment.ThumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+			h.deleteAttachmentFiles(ctx, attachment)
+			c.Logger().Errorf("Error storing thumbnail: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to store attachment")
+		}
+	}
+
+	if err := h.DB.Create(attachment).Error; err != nil {
+		h.deleteAttachmentFiles(ctx, attachment)
+		c.Logger().Errorf("Database error creating attachment for post %d: %v", post.ID, err)
+		return dbError(err, "Failed to store attachment")
+	}
+
+	return c.JSON(http.StatusCreated, h.withURLs(attachment))
+}
+
+func (h *Handler) getAttachments(c echo.Context) error {
+	postID, err := h.findPostForComments(c)
+	if postID == 0 {
+		return err
+	}
+
+	attachments := []Attachment{}
+	if err := h.DB.Where("post_id = ?", postID).Order("id").Find(&attachments).Error; err != nil {
+		c.Logger().Errorf("Database error fetching attachments of post %d: %v", postID, err)
+		return dbError(err, "Failed to fetch attachments")
+	}
+	for i := range attachments {
+		h.withURLs(&attachments[i])
+	}
+	return c.JSON(http.StatusOK, attachments)
+}
+
+func (h *Handler) deleteAttachment(c echo.Context) error {
+	post, err := h.findEditablePost(c)
+	if post == nil {
+		return err
+	}
+
+	id, err := strconv.ParseUint(c.Param("attachmentID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment ID format")
+	}
+
+	var attachment Attachment
+	if err := h.DB.Where("post_id = ?", post.ID).First(&attachment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+		}
+		c.Logger().Errorf("Database error fetching attachment %d: %v", id, err)
+		return dbError(err, "Failed to delete attachment")
+	}
+
+	if err := h.DB.Delete(&attachment).Error; err != nil {
+		c.Logger().Errorf("Database error deleting attachment %d: %v", id, err)
+		return dbError(err, "Failed to delete attachment")
+	}
+	h.deleteAttachmentFiles(c.Request().Context(), &attachment)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) serveAttachment(c echo.Context, thumbnail bool) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid attachment ID format")
+	}
+
+	var attachment Attachment
+	if err := h.DB.First(&attachment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+		}
+		c.Logger().Errorf("Database error fetching attachment %d: %v", id, err)
+		return dbError(err, "Failed to fetch attachment")
+	}
+
+	// Files follow the visibility of their post, including the trash.
+	var post Post
+	err = h.DB.Select("id", "status", "author_id").First(&post, attachment.PostID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !canView(currentUser(c), &post)) {
+		return echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+	}
+	if err != nil {
+		c.Logger().Errorf("Database error fetching post %d: %v", attachment.PostID, err)
+		return dbError(err, "Failed to fetch attachment")
+	}
+
+	key, contentType, etag := attachment.StorageKey, attachment.ContentType, `"a`+c.Param("id")+`"`
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			return echo.NewHTTPError(http.StatusNotFound, "Attachment has no thumbnail")
+		}
+		key, contentType, etag = attachment.ThumbnailKey, attachment.ThumbnailContentType, `"t`+c.Param("id")+`"`
+	}
+
+	f, err := h.Storage.Open(c.Request().Context(), key)
+	if err != nil {
+		c.Logger().Errorf("Error opening attachment file %s: %v", key, err)
+		return echo.NewHTTPError(http.StatusNotFound, "Attachment not found")
+	}
+	defer f.Close()
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set("ETag", etag)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	// Stored files never change under the same ID, but their post can still
+	// be unpublished, so public copies are only cached briefly and then
+	// revalidated against the ETag. Drafts must not end up in shared caches.
+	if post.Status == StatusPublished {
+		header.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(attachmentMaxAge.Seconds())))
+	} else {
+		header.Set("Cache-Control", "private, no-cache")
+	}
+	disposition := "inline"
+	if !thumbnail && attachment.Width == 0 {
+		disposition = "attachment"
+	}
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+
+	http.ServeContent(c.Response(), c.Request(), "", attachment.CreatedAt, f)
+	return nil
+}
+
+func (h *Handler) getAttachmentFile(c echo.Context) error {
+	return h.serveAttachment(c, false)
+}
+
+func (h *Handler) getAttachmentThumbnail(c echo.Context) error {
+	return h.serveAttachment(c, true)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// upload posts a file to the attachments of post.
+func (s *testServer) upload(t *testing.T, token string, post Post, filename string, data []byte) *Attachment {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	rec := s.do(http.MethodPost, fmt.Sprintf("/posts/%d/attachments", post.ID), token, body.String(), echo.HeaderContentType, mw.FormDataContentType())
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload %s = %d %s", filename, rec.Code, rec.Body)
+	}
+	return decodeJSON[*Attachment](t, rec)
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAttachments(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleEditor)
+	post := s.createPost(t, author, map[string]any{"title": "Pictures", "content": "x", "status": StatusPublished})
+	draft := s.createPost(t, author, map[string]any{"title": "Draft", "content": "x"})
+
+	photo := s.upload(t, author, post, "../../photo.png", pngImage(t, 640, 480))
+	if photo.Filename != "photo.png" || photo.Width != 640 || photo.ThumbnailURL == "" {
+		t.Errorf("uploaded image = %+v", photo)
+	}
+	rec := s.do(http.MethodGet, fmt.Sprintf("/attachments/%d/thumbnail", photo.ID), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET thumbnail = %d", rec.Code)
+	}
+	if thumb, err := png.Decode(rec.Body); err != nil || thumb.Bounds().Dx() != thumbnailSize {
+		t.Errorf("thumbnail: %v, %v", thumb.Bounds(), err)
+	}
+
+	// Published files are cached briefly, since the post may be unpublished.
+	path := fmt.Sprintf("/attachments/%d", photo.ID)
+	rec = s.do(http.MethodGet, path, "", nil)
+	if got := rec.Header().Get("Cache-Control"); rec.Code != http.StatusOK || got != "public, max-age=300" {
+		t.Errorf("GET published attachment = %d, Cache-Control %q", rec.Code, got)
+	}
+	if rec := s.do(http.MethodGet, path, "", nil, "If-None-Match", rec.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with If-None-Match = %d, want 304", rec.Code)
+	}
+
+	hidden := s.upload(t, author, draft, "notes.txt", []byte("plain text notes"))
+	path = fmt.Sprintf("/attachments/%d", hidden.ID)
+	if rec := s.do(http.MethodGet, path, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET draft attachment anonymously = %d, want 404", rec.Code)
+	}
+	rec = s.do(http.MethodGet, path, author, nil)
+	if got := rec.Header().Get("Cache-Control"); rec.Code != http.StatusOK || got != "private, no-cache" {
+		t.Errorf("GET draft attachment as its author = %d, Cache-Control %q", rec.Code, got)
+	}
+	if got := rec.Header().Get(echo.HeaderContentDisposition); got != `attachment; filename=notes.txt` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+const minPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+
+var errUsernameTaken = errors.New("username taken")
+
+type User struct {
+	gorm.Model
+	Username     string `json:"username" gorm:"uniqueIndex;not null"`
+	PasswordHash string `json:"-" gorm:"not null"`
+	Role         string `json:"role" gorm:"not null;default:author"`
+}
+
+type authUser struct {
+	ID       uint
+	Username string
+	Role     string
+}
+
+type authClaims struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Type     string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// dummyPasswordHash keeps login timing the same whether or not the user exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+func (h *Handler) signToken(user *User, typ string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := authClaims{
+		Username: user.Username,
+		Role:     user.Role,
+		Type:     typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.Config.JWTSecret)
+}
+
+func (h *Handler) issueTokens(user *User) (*tokenResponse, error) {
+	access, err := h.signToken(user, accessToken, h.Config.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := h.signToken(user, refreshToken, h.Config.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.Config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (h *Handler) parseToken(raw, typ string) (*authClaims, error) {
+	claims := new(authClaims)
+	_, err := jwt.ParseWithClaims(raw, claims, func(*jwt.Token) (any, error) {
+		return h.Config.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != typ {
+		return nil, errors.New("wrong token type")
+	}
+	return claims, nil
+}
+
+func (h *Handler) userFromRequest(c echo.Context) (*authUser, error) {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	raw, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || raw == "" {
+		return nil, errors.New("missing bearer token")
+	}
+
+	claims, err := h.parseToken(raw, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// The role in the token may be stale: it is read from the database so
+	// that a demotion or a deleted account takes effect on the next request.
+	user := new(authUser)
+	if err := h.DB.Model(&User{}).Select("id", "username", "role").Where("id = ?", id).Take(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// authenticate stores the caller in the context for currentUser when the
+// request carries a valid access token. Anonymous requests pass through.
+func (h *Handler) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if user, err := h.userFromRequest(c); err == nil {
+			c.Set("user", user)
+		}
+		return next(c)
+	}
+}
+
+func requireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if currentUser(c) == nil {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="blog"`)
+			return echo.NewHTTPError(http.StatusUnauthorized, "Missing or invalid access token")
+		}
+		return next(c)
+	}
+}
+
+func currentUser(c echo.Context) *authUser {
+	user, _ := c.Get("user").(*authUser)
+	return user
+}
+
+func (h *Handler) register(c echo.Context) error {
+	var input credentials
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+
+	input.Username = strings.ToLower(strings.TrimSpace(input.Username))
+	if !usernamePattern.MatchString(input.Username) {
+		return &FieldError{Field: "username", Code: "pattern", Message: "must be 3-32 characters of a-z, 0-9, _ or -"}
+	}
+	if len(input.Password) < minPasswordLength {
+		return &FieldError{Field: "password", Code: "min", Message: "must be at least 8 characters"}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return &FieldError{Field: "password", Code: "max", Message: "must be at most 72 bytes"}
+		}
+		c.Logger().Errorf("Error hashing password: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to register user")
+	}
+
+	user := &User{Username: input.Username, PasswordHash: string(hash), Role: h.Config.DefaultRole}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errUsernameTaken
+		}
+		return tx.Create(user).Error
+	})
+	if errors.Is(err, errUsernameTaken) {
+		return echo.NewHTTPError(http.StatusConflict, "Username is already taken")
+	}
+	if err != nil {
+		c.Logger().Errorf("Database error registering user %q: %v", input.Username, err)
+		return dbError(err, "Failed to register user")
+	}
+
+	return c.JSON(http.StatusCreated, user)
+}
+
+// ensureAdmin creates the admin account named by BLOG_ADMIN_USERNAME before
+// the server accepts requests. Registration only ever creates authors, so this
+// is the only way to get a first admin. An existing account of that name must
+// already be an admin: promoting it could hand the blog to whoever registered
+// the name first.
+func ensureAdmin(db *gorm.DB, username, password string) error {
+	if username == "" {
+		var admins int64
+		if err := db.Model(&User{}).Where("role = ?", RoleAdmin).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins == 0 {
+			log.Println("There is no admin account yet, set BLOG_ADMIN_USERNAME and BLOG_ADMIN_PASSWORD to create one")
+		}
+		return nil
+	}
+
+	var user User
+	err := db.Where("username = ?", username).First(&user).Error
+	if err == nil {
+		if user.Role != RoleAdmin {
+			return fmt.Errorf("user %q already exists and is not an admin", username)
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid admin username %q", username)
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("BLOG_ADMIN_PASSWORD must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := db.Create(&User{Username: username, PasswordHash: string(hash), Role: RoleAdmin}).Error; err != nil {
+		return err
+	}
+	log.Printf("Created admin account %q", username)
+	return nil
+}
+
+func (h *Handler) login(c echo.Context) error {
+	var input credentials
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+
+	var user User
+	err := h.DB.Where("username = ?", strings.ToLower(strings.TrimSpace(input.Username))).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Logger().Errorf("Database error fetching user %q: %v", input.Username, err)
+		return dbError(err, "Failed to log in")
+	}
+
+	hash := []byte(user.PasswordHash)
+	if err != nil {
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(input.Password)) != nil || user.ID == 0 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid username or password")
+	}
+
+	tokens, err := h.issueTokens(&user)
+	if err != nil {
+		c.Logger().Errorf("Error signing tokens for user %d: %v", user.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to log in")
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) refresh(c echo.Context) error {
+	var input refreshInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+
+	claims, err := h.parseToken(input.RefreshToken, refreshToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid refresh token")
+	}
+
+	// Reload the user so deleted accounts and role changes take effect.
+	var user User
+	if err := h.DB.First(&user, claims.Subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "Invalid refresh token")
+		}
+		c.Logger().Errorf("Database error fetching user %s: %v", claims.Subject, err)
+		return dbError(err, "Failed to refresh token")
+	}
+
+	tokens, err := h.issueTokens(&user)
+	if err != nil {
+		c.Logger().Errorf("Error signing tokens for user %d: %v", user.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to refresh token")
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRegisterNeverCreatesAdmins(t *testing.T) {
+	s := newTestServer(t)
+	for _, name := range []string{"first", "second"} {
+		rec := s.do(http.MethodPost, "/auth/register", "", credentials{Username: name, Password: "long enough"})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("register %s = %d %s", name, rec.Code, rec.Body)
+		}
+		if user := decodeJSON[User](t, rec); user.Role != RoleReader {
+			t.Errorf("%s registered as %q, want %q", name, user.Role, RoleReader)
+		}
+	}
+}
+
+func TestDefaultRole(t *testing.T) {
+	t.Setenv("BLOG_DEFAULT_ROLE", RoleAuthor)
+	s := newTestServer(t)
+	rec := s.do(http.MethodPost, "/auth/register", "", credentials{Username: "writer", Password: "long enough"})
+	if user := decodeJSON[User](t, rec); user.Role != RoleAuthor {
+		t.Errorf("registered as %q with BLOG_DEFAULT_ROLE=author", user.Role)
+	}
+
+	t.Setenv("BLOG_DEFAULT_ROLE", RoleAdmin)
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig accepted BLOG_DEFAULT_ROLE=admin")
+	}
+}
+
+func TestEnsureAdmin(t *testing.T) {
+	s := newTestServer(t)
+
+	if err := ensureAdmin(s.DB, "", ""); err != nil {
+		t.Fatalf("without BLOG_ADMIN_USERNAME: %v", err)
+	}
+	if err := ensureAdmin(s.DB, "root", "short"); err == nil {
+		t.Error("created an admin with a short password")
+	}
+	if err := ensureAdmin(s.DB, "root", "long enough"); err != nil {
+		t.Fatal(err)
+	}
+	// Restarting with the same settings keeps the account.
+	if err := ensureAdmin(s.DB, "root", "long enough"); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+
+	rec := s.do(http.MethodPost, "/auth/login", "", credentials{Username: "root", Password: "long enough"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin login = %d %s", rec.Code, rec.Body)
+	}
+	claims, err := s.parseToken(decodeJSON[tokenResponse](t, rec).AccessToken, accessToken)
+	if err != nil || claims.Role != RoleAdmin {
+		t.Errorf("admin token claims = %+v, %v", claims, err)
+	}
+
+	// Whoever registered a name first must not be promoted by naming it.
+	rec = s.do(http.MethodPost, "/auth/register", "", credentials{Username: "squatter", Password: "long enough"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", rec.Code, rec.Body)
+	}
+	if err := ensureAdmin(s.DB, "squatter", "long enough"); err == nil {
+		t.Error("promoted an existing author to admin")
+	}
+}
+
+func TestOnlyAuthorsModifyPosts(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "author", RoleAuthor)
+	other := s.login(t, "other", RoleAuthor)
+	admin := s.login(t, "admin", RoleAdmin)
+	post := s.createPost(t, author, map[string]any{"title": "Mine", "content": "Hands off."})
+	path := fmt.Sprintf("/posts/%d", post.ID)
+	update := map[string]any{"title": "Changed", "content": "Changed."}
+
+	if rec := s.do(http.MethodPut, path, "", update); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous update = %d, want 401", rec.Code)
+	}
+	if rec := s.do(http.MethodPut, path, other, update); rec.Code != http.StatusForbidden {
+		t.Errorf("update by another author = %d, want 403", rec.Code)
+	}
+	if rec := s.do(http.MethodPut, path, author, update); rec.Code != http.StatusOK {
+		t.Errorf("update by its author = %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodDelete, path, admin, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete by an admin = %d %s", rec.Code, rec.Body)
+	}
+}
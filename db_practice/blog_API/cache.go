@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxCachedBodySize = 1 << 20
+
+// cachedHeaders are the response headers replayed from a cache entry.
+var cachedHeaders = []string{echo.HeaderContentType, "ETag", echo.HeaderLastModified}
+
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// CacheStats are the counters of a ResponseCache since it was created.
+type CacheStats struct {
+	Entries       int    `json:"entries"`
+	Capacity      int    `json:"capacity"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// ResponseCache is an in-process LRU cache of GET responses with a TTL per
+// entry. Purge drops everything and bumps a generation, so a response that
+// was being built while a write committed is not stored afterwards.
+type ResponseCache struct {
+	mu         sync.Mutex
+	capacity   int
+	entries    map[string]*list.Element
+	lru        *list.List
+	generation uint64
+	stats      CacheStats
+}
+
+func NewResponseCache(capacity int) *ResponseCache {
+	return &ResponseCache{capacity: capacity, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+func (rc *ResponseCache) Get(key string) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	el, ok := rc.entries[key]
+	if ok && time.Now().After(el.Value.(*cacheEntry).expires) {
+		rc.lru.Remove(el)
+		delete(rc.entries, key)
+		ok = false
+	}
+	if !ok {
+		rc.stats.Misses++
+		return nil, false
+	}
+	rc.stats.Hits++
+	rc.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// Generation is passed back to Set, see ResponseCache.
+func (rc *ResponseCache) Generation() uint64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.generation
+}
+
+func (rc *ResponseCache) Set(entry *cacheEntry, generation uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.capacity <= 0 || generation != rc.generation {
+		return
+	}
+	if el, ok := rc.entries[entry.key]; ok {
+		el.Value = entry
+		rc.lru.MoveToFront(el)
+		return
+	}
+	rc.entries[entry.key] = rc.lru.PushFront(entry)
+	for rc.lru.Len() > rc.capacity {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+		rc.stats.Evictions++
+	}
+}
+
+func (rc *ResponseCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries = make(map[string]*list.Element)
+	rc.lru.Init()
+	rc.generation++
+	rc.stats.Invalidations++
+}
+
+func (rc *ResponseCache) Stats() CacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	stats := rc.stats
+	stats.Entries, stats.Capacity = rc.lru.Len(), rc.capacity
+	return stats
+}
+
+// teeWriter passes a response through while keeping a copy for the cache.
+type teeWriter struct {
+	http.ResponseWriter
+	buf      bytes.Buffer
+	overflow bool
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	if !w.overflow {
+		if w.buf.Len()+len(b) > maxCachedBodySize {
+			w.overflow = true
+			w.buf = bytes.Buffer{}
+		} else {
+			w.buf.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// cacheKey is the request path with its query in canonical order, so
+// ?a=1&b=2 and ?b=2&a=1 share an entry.
+func cacheKey(c echo.Context) string {
+	u := c.Request().URL
+	if len(u.RawQuery) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + u.Query().Encode()
+}
+
+// cacheResponses serves GET requests on the routes in Config.CacheTTLs from
+// the response cache. Only anonymous requests are cached, as logged in users
+// may see drafts. Any successful write purges the whole cache; posts change
+// rarely enough that finer invalidation isn't worth its bugs.
+func (h *Handler) cacheResponses(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if isWrite(c) {
+			err := next(c)
+			// Logging in changes nothing a cached response shows.
+			if err == nil && c.Response().Status < http.StatusBadRequest && !strings.HasPrefix(c.Path(), "/auth/") {
+				h.Cache.Purge()
+			}
+			return err
+		}
+
+		ttl, ok := h.Config.CacheTTLs[c.Path()]
+		if !ok || ttl <= 0 || req.Method != http.MethodGet {
+			return next(c)
+		}
+		res := c.Response()
+		res.Header().Add(echo.HeaderVary, echo.HeaderAuthorization)
+		if currentUser(c) != nil {
+			return next(c)
+		}
+
+		key := cacheKey(c)
+		if entry, ok := h.Cache.Get(key); ok {
+			res.Header().Set("X-Cache", "HIT")
+			return entry.write(c)
+		}
+		res.Header().Set("X-Cache", "MISS")
+
+		generation := h.Cache.Generation()
+		tee := &teeWriter{ResponseWriter: res.Writer}
+		res.Writer = tee
+		err := next(c)
+		res.Writer = tee.ResponseWriter
+
+		if err == nil && res.Status == http.StatusOK && !tee.overflow {
+			entry := &cacheEntry{key: key, status: res.Status, header: make(http.Header), body: tee.buf.Bytes(), expires: time.Now().Add(ttl)}
+			for _, name := range cachedHeaders {
+				if v := res.Header().Get(name); v != "" {
+					entry.header.Set(name, v)
+				}
+			}
+			h.Cache.Set(entry, generation)
+		}
+		return err
+	}
+}
+
+func isWrite(c echo.Context) bool {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func (e *cacheEntry) write(c echo.Context) error {
+	header := c.Response().Header()
+	for name, values := range e.header {
+		header[name] = values
+	}
+	lastModified, _ := http.ParseTime(e.header.Get(echo.HeaderLastModified))
+	if conditionalGET(c, e.header.Get("ETag"), lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(e.status, e.header.Get(echo.HeaderContentType), e.body)
+}
+
+// bodyETag is a strong ETag over the exact bytes of a response.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// conditionalJSON writes v as JSON with an ETag over the encoded body,
+// answering 304 when the client's copy is still current.
+func conditionalJSON(c echo.Context, v any, lastModified time.Time) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if conditionalGET(c, bodyETag(body), lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSONBlob(http.StatusOK, body)
+}
+
+func (h *Handler) getCacheStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.Cache.Stats())
+}
+
+func (h *Handler) purgeCache(c echo.Context) error {
+	h.Cache.Purge()
+	return c.NoContent(http.StatusNoContent)
+}
+
+// cacheTTLsFromEnv reads BLOG_CACHE_ROUTES, such as "/posts=1m,/tags=off",
+// on top of the defaults. Routes are Echo route templates.
+func cacheTTLsFromEnv(defaults map[string]time.Duration) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration, len(defaults))
+	for route, ttl := range defaults {
+		ttls[route] = ttl
+	}
+
+	s := stringEnv("BLOG_CACHE_ROUTES", "")
+	if s == "" {
+		return ttls, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("BLOG_CACHE_ROUTES: invalid entry %q, want route=ttl", item)
+		}
+		if value == "off" {
+			ttls[route] = 0
+			continue
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("BLOG_CACHE_ROUTES: invalid ttl %q for %s", value, route)
+		}
+		ttls[route] = ttl
+	}
+	return ttls, nil
+}
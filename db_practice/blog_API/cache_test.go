@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleEditor)
+	post := s.createPost(t, author, map[string]any{"title": "Cached", "content": "First", "status": StatusPublished})
+	path := fmt.Sprintf("/posts/%d", post.ID)
+
+	get := func(token string, header ...string) (string, int, string) {
+		t.Helper()
+		rec := s.do(http.MethodGet, path, token, nil, header...)
+		return rec.Header().Get("X-Cache"), rec.Code, rec.Body.String()
+	}
+
+	if state, _, _ := get(""); state != "MISS" {
+		t.Errorf("first GET: X-Cache %q, want MISS", state)
+	}
+	state, code, body := get("")
+	if state != "HIT" || code != http.StatusOK || !strings.Contains(body, "First") {
+		t.Errorf("second GET: X-Cache %q, %d %s, want a HIT", state, code, body)
+	}
+
+	etag := s.do(http.MethodGet, path, "", nil).Header().Get("ETag")
+	if state, code, body := get("", "If-None-Match", etag); state != "HIT" || code != http.StatusNotModified || body != "" {
+		t.Errorf("GET with a current If-None-Match = %s %d %q, want a 304 from the cache", state, code, body)
+	}
+	if _, code, _ := get("", "If-None-Match", `"stale"`); code != http.StatusOK {
+		t.Errorf("GET with a stale If-None-Match = %d, want 200", code)
+	}
+
+	if state, code, _ := get(author); state != "" || code != http.StatusOK {
+		t.Errorf("authenticated GET: X-Cache %q, want the cache bypassed", state)
+	}
+
+	rec := s.do(http.MethodPut, path, author, map[string]any{"title": "Cached", "content": "Second", "status": StatusPublished})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+	}
+	state, _, body = get("")
+	if state != "MISS" || !strings.Contains(body, "Second") {
+		t.Errorf("GET after a write: X-Cache %q, %s, want a fresh copy", state, body)
+	}
+	if _, code, _ := get("", "If-None-Match", etag); code != http.StatusOK {
+		t.Errorf("GET with the ETag from before the write = %d, want 200", code)
+	}
+
+	// Unpublishing a post must not leave it readable from the cache.
+	get("")
+	rec = s.do(http.MethodPatch, path, author, `{"status": "draft"}`, "Content-Type", mimeMergePatch)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+	if _, code, _ := get(""); code != http.StatusNotFound {
+		t.Errorf("anonymous GET of an unpublished post = %d, want 404", code)
+	}
+}
+
+func TestPublisherPurgesCache(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleEditor)
+	publishAt := time.Now().Add(time.Hour)
+	post := s.createPost(t, author, map[string]any{"title": "Later", "content": "Body", "status": StatusScheduled, "publish_at": publishAt})
+
+	list := func() []Post {
+		t.Helper()
+		return decodeJSON[page[Post]](t, s.do(http.MethodGet, "/posts", "", nil)).Data
+	}
+	if posts := list(); len(posts) != 0 {
+		t.Fatalf("listed %d posts before publishing", len(posts))
+	}
+	if err := s.DB.Model(&Post{}).Where("id = ?", post.ID).Update("publish_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if posts := list(); len(posts) != 0 {
+		t.Fatal("the cached list changed without a purge; the test can't tell the publisher purges it")
+	}
+
+	purged := s.Cache.Stats().Invalidations
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runPublisher(ctx, s.DB, time.Hour, s.Cache)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Cache.Stats().Invalidations == purged && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+
+	if posts := list(); len(posts) != 1 || posts[0].ID != post.ID {
+		t.Errorf("listed %+v after the publisher ran, want the scheduled post", posts)
+	}
+}
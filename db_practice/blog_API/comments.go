@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCommentDepth = 3
+	maxCommentDepth     = 10
+)
+
+type Comment struct {
+	gorm.Model
+	PostID   uint       `json:"post_id" gorm:"not null;index"`
+	ParentID *uint      `json:"parent_id" gorm:"index"`
+	UserID   uint       `json:"user_id" gorm:"index"`
+	Author   string     `json:"author"`
+	Content  string     `json:"content" gorm:"not null" validate:"required,max=10000"`
+	Replies  []*Comment `json:"replies,omitempty" gorm:"-"`
+}
+
+type commentInput struct {
+	Content string `json:"content" validate:"required,max=10000"`
+}
+
+func encodeCommentCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeCommentCursor(s string) (uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, errors.New("Invalid cursor")
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, errors.New("Invalid cursor")
+	}
+	return uint(id), nil
+}
+
+// findPostForComments makes sure the post in the URL exists, hasn't been
+// deleted and is visible to the caller.
+func (h *Handler) findPostForComments(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
+	}
+
+	var post Post
+	if err := h.DB.Select("id", "status", "author_id").First(&post, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, echo.NewHTTPError(http.StatusNotFound, "Post not found")
+		}
+		c.Logger().Errorf("Database error fetching post %d for comments: %v", id, err)
+		return 0, dbError(err, "Failed to fetch post")
+	}
+	if !canView(currentUser(c), &post) {
+		return 0, echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	}
+	return post.ID, nil
+}
+
+func (h *Handler) findComment(c echo.Context, postID uint) (*Comment, error) {
+	id, err := strconv.ParseUint(c.Param("commentID"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid comment ID format")
+	}
+
+	comment := new(Comment)
+	if err := h.DB.Where("post_id = ?", postID).First(comment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Comment not found")
+		}
+		c.Logger().Errorf("Database error fetching comment %d: %v", id, err)
+		return nil, dbError(err, "Failed to fetch comment")
+	}
+	return comment, nil
+}
+
+// getComments returns a page of top-level comments, each with its replies
+// nested up to the requested depth.
+func (h *Handler) getComments(c echo.Context) error {
+	postID, err := h.findPostForComments(c)
+	if postID == 0 {
+		return err
+	}
+
+	limit := defaultPageLimit
+	if s := c.QueryParam("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit, must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+	}
+	depth := defaultCommentDepth
+	if s := c.QueryParam("depth"); s != "" {
+		depth, err = strconv.Atoi(s)
+		if err != nil || depth < 1 || depth > maxCommentDepth {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid depth, must be between 1 and "+strconv.Itoa(maxCommentDepth))
+		}
+	}
+
+	q := h.DB.Model(&Comment{}).Where("post_id = ? AND parent_id IS NULL", postID)
+	if s := c.QueryParam("cursor"); s != "" {
+		after, err := decodeCommentCursor(s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		q = q.Where("id > ?", after)
+	}
+
+	var rootIDs []uint
+	if err := q.Order("id").Limit(limit+1).Pluck("id", &rootIDs).Error; err != nil {
+		c.Logger().Errorf("Database error fetching comments for post %d: %v", postID, err)
+		return dbError(err, "Failed to fetch comments")
+	}
+
+	result := page[*Comment]{Data: []*Comment{}, Pagination: pageInfo{Limit: limit}}
+	if len(rootIDs) > limit {
+		rootIDs = rootIDs[:limit]
+		result.Pagination.NextCursor = encodeCommentCursor(rootIDs[limit-1])
+	}
+	if len(rootIDs) == 0 {
+		return c.JSON(http.StatusOK, result)
+	}
+
+	var comments []*Comment
+	err = h.DB.Raw(`WITH RECURSIVE thread(id, depth) AS (
+			SELECT id, 1 FROM comments WHERE id IN ?
+			UNION ALL
+			SELECT comments.id, thread.depth + 1 FROM comments
+			JOIN thread ON comments.parent_id = thread.id
+			WHERE comments.deleted_at IS NULL AND thread.depth < ?
+		)
+		SELECT comments.* FROM comments JOIN thread ON comments.id = thread.id
+		ORDER BY comments.id`, rootIDs, depth).Scan(&comments).Error
+	if err != nil {
+		c.Logger().Errorf("Database error fetching comment threads for post %d: %v", postID, err)
+		return dbError(err, "Failed to fetch comments")
+	}
+
+	byID := make(map[uint]*Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			result.Data = append(result.Data, comment)
+		} else if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) createComment(c echo.Context) error {
+	postID, err := h.findPostForComments(c)
+	if postID == 0 {
+		return err
+	}
+
+	comment := new(Comment)
+	if err := c.Bind(comment); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+	if err := validate.Struct(comment); err != nil {
+		return err
+	}
+	user := currentUser(c)
+	comment.ID, comment.PostID, comment.Replies = 0, postID, nil
+	comment.UserID, comment.Author = user.ID, user.Username
+
+	if comment.ParentID != nil {
+		var parent Comment
+		err := h.DB.Select("id").Where("post_id = ?", postID).First(&parent, *comment.ParentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Parent comment not found on this post")
+		}
+		if err != nil {
+			c.Logger().Errorf("Database error fetching parent comment %d: %v", *comment.ParentID, err)
+			return dbError(err, "Failed to create comment")
+		}
+	}
+
+	if err := h.DB.Create(comment).Error; err != nil {
+		c.Logger().Errorf("Database error creating comment on post %d: %v", postID, err)
+		return dbError(err, "Failed to create comment")
+	}
+
+	return c.JSON(http.StatusCreated, comment)
+}
+
+func (h *Handler) updateComment(c echo.Context) error {
+	postID, err := h.findPostForComments(c)
+	if postID == 0 {
+		return err
+	}
+	comment, err := h.findComment(c, postID)
+	if comment == nil {
+		return err
+	}
+	if err := authorizeOwned(currentUser(c), comment.UserID, PermComment, PermModerateComments); err != nil {
+		return err
+	}
+
+	var input commentInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+	if err := validate.Struct(&input); err != nil {
+		return err
+	}
+
+	if err := h.DB.Model(comment).Update("content", input.Content).Error; err != nil {
+		c.Logger().Errorf("Database error updating comment %d: %v", comment.ID, err)
+		return dbError(err, "Failed to update comment")
+	}
+
+	return c.JSON(http.StatusOK, comment)
+}
+
+// deleteComment soft-deletes a comment together with all of its replies.
+func (h *Handler) deleteComment(c echo.Context) error {
+	postID, err := h.findPostForComments(c)
+	if postID == 0 {
+		return err
+	}
+	comment, err := h.findComment(c, postID)
+	if comment == nil {
+		return err
+	}
+	if err := authorizeOwned(currentUser(c), comment.UserID, PermComment, PermModerateComments); err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Raw(`WITH RECURSIVE subtree(id) AS (
+				SELECT ?
+				UNION ALL
+				SELECT comments.id FROM comments JOIN subtree ON comments.parent_id = subtree.id
+				WHERE comments.deleted_at IS NULL
+			)
+			SELECT id FROM subtree`, comment.ID).Scan(&ids).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&Comment{}, ids).Error
+	})
+	if err != nil {
+		c.Logger().Errorf("Database error deleting comment %d: %v", comment.ID, err)
+		return dbError(err, "Failed to delete comment")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// deletePostComments soft-deletes the live comments of a post. Run it in the
+// same session as the post delete so both share one DeletedAt timestamp.
+func deletePostComments(tx *gorm.DB, postID uint) error {
+	return tx.Where("post_id = ?", postID).Delete(&Comment{}).Error
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	BaseURL         string
+	SiteTitle       string
+	PostURLTemplate string
+	JWTSecret       []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	PublishInterval time.Duration
+	WebhookInterval time.Duration
+	TrashRetention  time.Duration
+	RequireIfMatch  bool
+	UploadDir       string
+	MaxUploadSize   int64
+	RateLimits      map[string]RateLimit
+	TrustProxy      bool
+	ShutdownTimeout time.Duration
+	CacheSize       int
+	CacheTTLs       map[string]time.Duration
+	DefaultRole     string
+	StreamReplay    int
+
+	AllowPendingMigrations bool
+	// AdminUsername and AdminPassword create the admin account at startup,
+	// see ensureAdmin.
+	AdminUsername string
+	AdminPassword string
+}
+
+func loadConfig() (*Config, error) {
+	cfg := &Config{
+		BaseURL:         strings.TrimRight(stringEnv("BLOG_BASE_URL", "http://localhost:8080"), "/"),
+		SiteTitle:       stringEnv("BLOG_TITLE", "Blog"),
+		JWTSecret:       []byte(os.Getenv("BLOG_JWT_SECRET")),
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 7 * 24 * time.Hour,
+		PublishInterval: 30 * time.Second,
+		WebhookInterval: 5 * time.Second,
+		TrashRetention:  30 * 24 * time.Hour,
+		RequireIfMatch:  os.Getenv("BLOG_REQUIRE_IF_MATCH") == "true",
+		UploadDir:       stringEnv("BLOG_UPLOAD_DIR", "uploads"),
+		MaxUploadSize:   10 << 20,
+		TrustProxy:      os.Getenv("BLOG_TRUST_PROXY") == "true",
+		ShutdownTimeout: 10 * time.Second,
+		CacheSize:       1000,
+		AdminUsername:   os.Getenv("BLOG_ADMIN_USERNAME"),
+		AdminPassword:   os.Getenv("BLOG_ADMIN_PASSWORD"),
+		DefaultRole:     stringEnv("BLOG_DEFAULT_ROLE", RoleReader),
+		StreamReplay:    1000,
+	}
+
+	// Feeds and the sitemap link to posts on the public site, which need not
+	// be this API. {id} and {slug} stand for the ID and slug of the post.
+	cfg.PostURLTemplate = stringEnv("BLOG_POST_URL", cfg.BaseURL+"/posts/by-slug/{slug}")
+	if !strings.Contains(cfg.PostURLTemplate, "{id}") && !strings.Contains(cfg.PostURLTemplate, "{slug}") {
+		return nil, errors.New("BLOG_POST_URL must contain {id} or {slug}")
+	}
+
+	if len(cfg.JWTSecret) == 0 {
+		log.Println("BLOG_JWT_SECRET is not set, using a random secret; tokens will not survive a restart")
+		cfg.JWTSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.JWTSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if cfg.AccessTokenTTL, err = durationEnv("BLOG_ACCESS_TOKEN_TTL", cfg.AccessTokenTTL); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshTokenTTL, err = durationEnv("BLOG_REFRESH_TOKEN_TTL", cfg.RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+	if cfg.PublishInterval, err = durationEnv("BLOG_PUBLISH_INTERVAL", cfg.PublishInterval); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookInterval, err = durationEnv("BLOG_WEBHOOK_INTERVAL", cfg.WebhookInterval); err != nil {
+		return nil, err
+	}
+	if cfg.TrashRetention, err = durationEnv("BLOG_TRASH_RETENTION", cfg.TrashRetention); err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownTimeout, err = durationEnv("BLOG_SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout); err != nil {
+		return nil, err
+	}
+	if s := os.Getenv("BLOG_MAX_UPLOAD_SIZE"); s != "" {
+		if cfg.MaxUploadSize, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	// New accounts can only read until an admin promotes them, unless
+	// BLOG_DEFAULT_ROLE opts in to open sign-up, e.g. as author. Admins are
+	// made by an admin, never by signing up.
+	if !isRole(cfg.DefaultRole) || cfg.DefaultRole == RoleAdmin {
+		return nil, fmt.Errorf("BLOG_DEFAULT_ROLE: invalid role %q", cfg.DefaultRole)
+	}
+
+	if s := os.Getenv("BLOG_CACHE_SIZE"); s != "" {
+		if cfg.CacheSize, err = strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+	}
+	if s := os.Getenv("BLOG_STREAM_REPLAY"); s != "" {
+		if cfg.StreamReplay, err = strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+	}
+	cfg.CacheTTLs, err = cacheTTLsFromEnv(map[string]time.Duration{
+		"/posts":               30 * time.Second,
+		"/posts/:id":           30 * time.Second,
+		"/posts/by-slug/:slug": 30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.RateLimits, err = rateLimitsFromEnv(map[string]RateLimit{
+		rateLimitAuth:  {Requests: 10, Period: time.Minute, Burst: 5},
+		rateLimitRead:  {Requests: 300, Period: time.Minute, Burst: 60},
+		rateLimitWrite: {Requests: 60, Period: time.Minute, Burst: 20},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func stringEnv(name, def string) string {
+	if s := os.Getenv(name); s != "" {
+		return s
+	}
+	return def
+}
+
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	errStaleVersion = errors.New("post version is stale")
+	errPostGone     = errors.New("post was deleted")
+)
+
+func postETag(post *Post) string {
+	return `"` + strconv.FormatUint(uint64(post.Version), 10) + `"`
+}
+
+// ifMatches reports whether an If-Match header matches etag, using the strong
+// comparison RFC 9110 requires.
+func ifMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifNoneMatches reports whether an If-None-Match header matches etag. GET
+// uses the weak comparison, so W/"1" matches "1".
+func ifNoneMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalGET sets the validators of a response and reports whether the
+// client's copy is current, so a 304 can be sent instead. If-None-Match wins
+// over If-Modified-Since, as RFC 9110 requires.
+func conditionalGET(c echo.Context, etag string, lastModified time.Time) bool {
+	header := c.Response().Header()
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	if !lastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	}
+
+	req := c.Request()
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		return etag != "" && ifNoneMatches(match, etag)
+	}
+	since, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince))
+	return err == nil && !lastModified.IsZero() && !lastModified.After(since)
+}
+
+// checkIfMatch enforces If-Match on a write to post. It returns the 428 or
+// 412 to send when the write must not go ahead.
+func (h *Handler) checkIfMatch(c echo.Context, post *Post) error {
+	header := c.Request().Header.Get("If-Match")
+	if header == "" {
+		if h.Config.RequireIfMatch {
+			return echo.NewHTTPError(http.StatusPreconditionRequired, "If-Match header is required")
+		}
+		return nil
+	}
+
+	if !ifMatches(header, postETag(post)) {
+		c.Response().Header().Set("ETag", postETag(post))
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "Post has been modified since it was fetched")
+	}
+	return nil
+}
+
+// versionMismatch tells why a write conditional on the version of post id
+// matched no row: the post was deleted meanwhile, or its version moved on.
+func versionMismatch(tx *gorm.DB, id uint) error {
+	var count int64
+	if err := tx.Model(&Post{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errPostGone
+	}
+	return errStaleVersion
+}
+
+// staleVersion answers a write that lost the race on the conditional UPDATE.
+func staleVersion(c echo.Context) error {
+	if c.Request().Header.Get("If-Match") != "" {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "Post has been modified since it was fetched")
+	}
+	return echo.NewHTTPError(http.StatusConflict, "Post was modified concurrently, please retry")
+}
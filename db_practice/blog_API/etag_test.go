@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleAuthor)
+	post := s.createPost(t, author, map[string]any{"title": "Title", "content": "Body"})
+	path := fmt.Sprintf("/posts/%d", post.ID)
+	update := map[string]any{"title": "Title", "content": "New body"}
+
+	etag := s.do(http.MethodGet, path, author, nil).Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag of a new post = %q", etag)
+	}
+
+	rec := s.do(http.MethodPut, path, author, update, "If-Match", etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT with current If-Match = %d %s", rec.Code, rec.Body)
+	}
+	newETag := rec.Header().Get("ETag")
+	if newETag == etag || s.do(http.MethodGet, path, author, nil).Header().Get("ETag") != newETag {
+		t.Errorf("ETag after a write = %q, was %q", newETag, etag)
+	}
+
+	rec = s.do(http.MethodPut, path, author, update, "If-Match", etag)
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("ETag") != newETag {
+		t.Errorf("PUT with stale If-Match = %d, ETag %q, want 412 with %q", rec.Code, rec.Header().Get("ETag"), newETag)
+	}
+	if rec := s.do(http.MethodDelete, path, author, nil, "If-Match", etag); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with stale If-Match = %d, want 412", rec.Code)
+	}
+
+	s.Config.RequireIfMatch = true
+	if rec := s.do(http.MethodPut, path, author, update); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("PUT without If-Match when required = %d, want 428", rec.Code)
+	}
+	if rec := s.do(http.MethodDelete, path, author, nil, "If-Match", "*"); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE with If-Match: * = %d, want 204", rec.Code)
+	}
+}
+
+// TestConcurrentWrites changes the post between the handler reading it and
+// its conditional UPDATE.
+func TestConcurrentWrites(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleAuthor)
+
+	for _, tc := range []struct {
+		name, meanwhile, ifMatch string
+		code                     int
+	}{
+		{"deleted", "UPDATE posts SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", `"1"`, http.StatusNotFound},
+		{"edited", "UPDATE posts SET version = version + 1 WHERE id = ?", `"1"`, http.StatusPreconditionFailed},
+		{"edited without If-Match", "UPDATE posts SET version = version + 1 WHERE id = ?", "", http.StatusConflict},
+	} {
+		post := s.createPost(t, author, map[string]any{"title": tc.name, "content": "Body"})
+
+		name := "test:" + tc.name
+		err := s.DB.Callback().Update().Before("gorm:update").Register(name, func(db *gorm.DB) {
+			db.Session(&gorm.Session{NewDB: true}).Exec(tc.meanwhile, post.ID)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := s.do(http.MethodPut, fmt.Sprintf("/posts/%d", post.ID), author, map[string]any{"title": "Mine", "content": "Body"}, "If-Match", tc.ifMatch)
+		s.DB.Callback().Update().Remove(name)
+
+		if rec.Code != tc.code {
+			t.Errorf("PUT of a post %s meanwhile = %d %s, want %d", tc.name, rec.Code, rec.Body, tc.code)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	feedSize    = 20
+	sitemapSize = 50000
+)
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Summary    string         `xml:"summary"`
+	Content    atomContent    `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// feedPost is a published post with the details every feed format needs.
+type feedPost struct {
+	Post
+	Author string
+}
+
+func (p *feedPost) published() time.Time {
+	if p.PublishedAt != nil {
+		return *p.PublishedAt
+	}
+	return p.CreatedAt
+}
+
+func (p *feedPost) tagNames() []string {
+	names := make([]string, 0, len(p.Tags))
+	for _, tag := range p.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// postURL is where readers find post on the public site, see BLOG_POST_URL.
+func (h *Handler) postURL(post *Post) string {
+	return strings.NewReplacer(
+		"{id}", strconv.FormatUint(uint64(post.ID), 10),
+		"{slug}", post.Slug,
+	).Replace(h.Config.PostURLTemplate)
+}
+
+// postsLastModified is the last time any post changed, deletions included,
+// truncated to the second precision of HTTP dates.
+func postsLastModified(db *gorm.DB) (time.Time, error) {
+	var latest time.Time
+	for _, column := range []string{"updated_at", "deleted_at"} {
+		var post Post
+		err := db.Unscoped().Select(column).Where(column + " IS NOT NULL").Order(column + " DESC").Take(&post).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if post.UpdatedAt.After(latest) {
+			latest = post.UpdatedAt
+		}
+		if post.DeletedAt.Valid && post.DeletedAt.Time.After(latest) {
+			latest = post.DeletedAt.Time
+		}
+	}
+	return latest.UTC().Truncate(time.Second), nil
+}
+
+// loadFeedPosts returns the latest published posts, optionally limited to one tag.
+func (h *Handler) loadFeedPosts(tag string, limit int) ([]feedPost, error) {
+	q := h.DB.Model(&Post{}).Preload("Tags").Where("posts.status = ?", StatusPublished)
+	if tag != "" {
+		q = tagFilter(q, []string{tag}, false)
+	}
+
+	var posts []Post
+	if err := q.Order("COALESCE(posts.published_at, posts.created_at) DESC").Limit(limit).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+
+	authorIDs := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		authorIDs = append(authorIDs, post.AuthorID)
+	}
+	var users []User
+	if err := h.DB.Select("id", "username").Find(&users, authorIDs).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+
+	result := make([]feedPost, len(posts))
+	for i, post := range posts {
+		result[i] = feedPost{Post: post, Author: usernames[post.AuthorID]}
+	}
+	return result, nil
+}
+
+// serveFeed handles the shared work of every feed endpoint: tag lookup,
+// conditional requests and loading posts.
+func (h *Handler) serveFeed(c echo.Context, render func(posts []feedPost, updated time.Time, selfURL string) error) error {
+	tag := ""
+	if name := c.Param("name"); name != "" {
+		tag = normalizeTagName(name)
+		var count int64
+		if err := h.DB.Model(&Tag{}).Where("name = ?", tag).Count(&count).Error; err != nil {
+			c.Logger().Errorf("Database error fetching tag %q: %v", tag, err)
+			return dbError(err, "Failed to build feed")
+		}
+		if count == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Tag not found")
+		}
+	}
+
+	lastModified, err := postsLastModified(h.DB)
+	if err != nil {
+		c.Logger().Errorf("Database error checking feed freshness: %v", err)
+		return dbError(err, "Failed to build feed")
+	}
+	if conditionalGET(c, "", lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	posts, err := h.loadFeedPosts(tag, feedSize)
+	if err != nil {
+		c.Logger().Errorf("Database error loading feed posts: %v", err)
+		return dbError(err, "Failed to build feed")
+	}
+	if lastModified.IsZero() {
+		lastModified = time.Now().UTC().Truncate(time.Second)
+	}
+
+	return render(posts, lastModified, h.Config.BaseURL+c.Request().URL.Path)
+}
+
+func (h *Handler) feedTitle(c echo.Context) string {
+	if name := c.Param("name"); name != "" {
+		return h.Config.SiteTitle + ": " + normalizeTagName(name)
+	}
+	return h.Config.SiteTitle
+}
+
+func xmlBlob(c echo.Context, contentType string, v any) error {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, contentType, append([]byte(xml.Header), out...))
+}
+
+func (h *Handler) getRSSFeed(c echo.Context) error {
+	return h.serveFeed(c, func(posts []feedPost, updated time.Time, selfURL string) error {
+		feed := rssFeed{
+			Version: "2.0",
+			AtomNS:  "http://www.w3.org/2005/Atom",
+			Channel: rssChannel{
+				Title:         h.feedTitle(c),
+				Link:          h.Config.BaseURL + "/",
+				Description:   "Latest posts from " + h.Config.SiteTitle,
+				LastBuildDate: updated.Format(time.RFC1123Z),
+				SelfLink:      atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"},
+			},
+		}
+		for i := range posts {
+			post := &posts[i]
+			url := h.postURL(&post.Post)
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       post.Title,
+				Link:        url,
+				GUID:        rssGUID{IsPermaLink: true, Value: url},
+				PubDate:     post.published().Format(time.RFC1123Z),
+				Description: post.ContentHTML,
+				Categories:  post.tagNames(),
+			})
+		}
+		return xmlBlob(c, "application/rss+xml; charset=utf-8", feed)
+	})
+}
+
+func (h *Handler) getAtomFeed(c echo.Context) error {
+	return h.serveFeed(c, func(posts []feedPost, updated time.Time, selfURL string) error {
+		feed := atomFeed{
+			Title:   h.feedTitle(c),
+			ID:      selfURL,
+			Updated: updated.Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+				{Href: h.Config.BaseURL + "/", Rel: "alternate"},
+			},
+			Author: atomPerson{Name: h.Config.SiteTitle},
+		}
+		for i := range posts {
+			post := &posts[i]
+			url := h.postURL(&post.Post)
+			entry := atomEntry{
+				Title:     post.Title,
+				ID:        url,
+				Link:      atomLink{Href: url, Rel: "alternate", Type: "text/html"},
+				Published: post.published().UTC().Format(time.RFC3339),
+				Updated:   post.UpdatedAt.UTC().Format(time.RFC3339),
+				Summary:   post.Excerpt,
+				Content:   atomContent{Type: "html", Value: post.ContentHTML},
+			}
+			if post.Author != "" {
+				entry.Author = &atomPerson{Name: post.Author}
+			}
+			for _, name := range post.tagNames() {
+				entry.Categories = append(entry.Categories, atomCategory{Term: name})
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		return xmlBlob(c, "application/atom+xml; charset=utf-8", feed)
+	})
+}
+
+func (h *Handler) getJSONFeed(c echo.Context) error {
+	return h.serveFeed(c, func(posts []feedPost, _ time.Time, selfURL string) error {
+		feed := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       h.feedTitle(c),
+			HomePageURL: h.Config.BaseURL + "/",
+			FeedURL:     selfURL,
+			Items:       []jsonFeedItem{},
+		}
+		for i := range posts {
+			post := &posts[i]
+			url := h.postURL(&post.Post)
+			item := jsonFeedItem{
+				ID:            url,
+				URL:           url,
+				Title:         post.Title,
+				ContentHTML:   post.ContentHTML,
+				Summary:       post.Excerpt,
+				DatePublished: post.published().Format(time.RFC3339),
+				DateModified:  post.UpdatedAt.Format(time.RFC3339),
+				Tags:          post.tagNames(),
+			}
+			if post.Author != "" {
+				item.Authors = []jsonFeedAuthor{{Name: post.Author}}
+			}
+			feed.Items = append(feed.Items, item)
+		}
+		c.Response().Header().Set(echo.HeaderContentType, "application/feed+json; charset=utf-8")
+		return c.JSON(http.StatusOK, feed)
+	})
+}
+
+func (h *Handler) getSitemap(c echo.Context) error {
+	lastModified, err := postsLastModified(h.DB)
+	if err != nil {
+		c.Logger().Errorf("Database error checking sitemap freshness: %v", err)
+		return dbError(err, "Failed to build sitemap")
+	}
+	if conditionalGET(c, "", lastModified) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	var posts []Post
+	err = h.DB.Select("id", "slug", "updated_at").Where("status = ?", StatusPublished).
+		Order("id").Limit(sitemapSize).Find(&posts).Error
+	if err != nil {
+		c.Logger().Errorf("Database error loading sitemap posts: %v", err)
+		return dbError(err, "Failed to build sitemap")
+	}
+
+	sitemap := sitemapURLSet{}
+	for i := range posts {
+		sitemap.URLs = append(sitemap.URLs, sitemapURL{
+			Loc:     h.postURL(&posts[i]),
+			LastMod: posts[i].UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return xmlBlob(c, "application/xml; charset=utf-8", sitemap)
+}
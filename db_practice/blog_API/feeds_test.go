@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedTestServer has one published post tagged "go", written by "alice", and
+// one draft that no feed may show.
+func feedTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := newTestServer(t)
+	token := s.login(t, "alice", RoleAdmin)
+	s.createPost(t, token, map[string]any{"title": "Hello feeds", "content": "Some *Markdown*.", "status": StatusPublished, "tags": []string{"go"}})
+	s.createPost(t, token, map[string]any{"title": "Secret draft", "content": "Not yet.", "status": StatusDraft})
+	return s
+}
+
+func getFeed(t *testing.T, s *testServer, path, contentType string) []byte {
+	t.Helper()
+	rec := s.do(http.MethodGet, path, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d %s", path, rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, contentType) {
+		t.Errorf("GET %s Content-Type = %q, want %s", path, got, contentType)
+	}
+	if strings.Contains(rec.Body.String(), "Secret draft") {
+		t.Errorf("GET %s lists a draft", path)
+	}
+	return rec.Body.Bytes()
+}
+
+func TestRSSFeed(t *testing.T) {
+	type rss struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			// atom:link shares the local name; the RSS link has no namespace.
+			Links []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:"link"`
+			Description string `xml:"description"`
+			Items       []struct {
+				Title       string   `xml:"title"`
+				Link        string   `xml:"link"`
+				GUID        string   `xml:"guid"`
+				PubDate     string   `xml:"pubDate"`
+				Description string   `xml:"description"`
+				Categories  []string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+
+	s := feedTestServer(t)
+	for _, path := range []string{"/feed.rss", "/tags/go/feed.rss"} {
+		var feed rss
+		if err := xml.Unmarshal(getFeed(t, s, path, "application/rss+xml"), &feed); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		if feed.Version != "2.0" {
+			t.Errorf("GET %s: version = %q, want 2.0", path, feed.Version)
+		}
+		ch := feed.Channel
+		link := ""
+		for _, l := range ch.Links {
+			if l.XMLName.Space == "" {
+				link = l.Value
+			}
+		}
+		if ch.Title == "" || link == "" || ch.Description == "" {
+			t.Errorf("GET %s: channel lacks a required element: %+v", path, ch)
+		}
+		if len(ch.Items) != 1 {
+			t.Fatalf("GET %s: %d items, want 1", path, len(ch.Items))
+		}
+		item := ch.Items[0]
+		if item.Title != "Hello feeds" || item.GUID == "" || !strings.HasPrefix(item.Link, "https://blog.example/posts/") {
+			t.Errorf("GET %s: item = %+v", path, item)
+		}
+		if _, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil {
+			t.Errorf("GET %s: pubDate is not RFC 822: %v", path, err)
+		}
+		if !strings.Contains(item.Description, "<em>Markdown</em>") {
+			t.Errorf("GET %s: description = %q, want rendered HTML", path, item.Description)
+		}
+		if len(item.Categories) != 1 || item.Categories[0] != "go" {
+			t.Errorf("GET %s: categories = %v, want [go]", path, item.Categories)
+		}
+	}
+}
+
+func TestAtomFeed(t *testing.T) {
+	s := feedTestServer(t)
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Title   string   `xml:"title"`
+		Updated string   `xml:"updated"`
+		Author  struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Title   string `xml:"title"`
+			Updated string `xml:"updated"`
+			Author  struct {
+				Name string `xml:"name"`
+			} `xml:"author"`
+			Content struct {
+				Type string `xml:"type,attr"`
+			} `xml:"content"`
+		} `xml:"entry"`
+	}
+
+	if err := xml.Unmarshal(getFeed(t, s, "/feed.atom", "application/atom+xml"), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.ID == "" || feed.Title == "" || feed.Author.Name == "" {
+		t.Errorf("feed lacks id, title or author: %+v", feed)
+	}
+	if _, err := time.Parse(time.RFC3339, feed.Updated); err != nil {
+		t.Errorf("feed updated is not RFC 3339: %v", err)
+	}
+	self := false
+	for _, link := range feed.Links {
+		self = self || (link.Rel == "self" && link.Href == "https://blog.example/feed.atom")
+	}
+	if !self {
+		t.Errorf("feed has no rel=self link: %+v", feed.Links)
+	}
+
+	if len(feed.Entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(feed.Entries))
+	}
+	entry := feed.Entries[0]
+	if entry.ID == "" || entry.Title != "Hello feeds" || entry.Author.Name != "alice" || entry.Content.Type != "html" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if _, err := time.Parse(time.RFC3339, entry.Updated); err != nil {
+		t.Errorf("entry updated is not RFC 3339: %v", err)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	s := feedTestServer(t)
+	rec := s.do(http.MethodGet, "/feed.json", "", nil)
+	getFeed(t, s, "/feed.json", "application/feed+json")
+	feed := decodeJSON[map[string]any](t, rec)
+
+	if feed["version"] != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("version = %v", feed["version"])
+	}
+	if title, _ := feed["title"].(string); title == "" {
+		t.Error("feed has no title")
+	}
+	items, ok := feed["items"].([]any)
+	if !ok || len(items) != 1 {
+		t.Fatalf("items = %v, want one item", feed["items"])
+	}
+	item := items[0].(map[string]any)
+	if id, _ := item["id"].(string); id == "" {
+		t.Errorf("item has no id: %v", item)
+	}
+	if html, _ := item["content_html"].(string); html == "" {
+		t.Errorf("item has neither content_html nor content_text: %v", item)
+	}
+	published, _ := item["date_published"].(string)
+	if _, err := time.Parse(time.RFC3339, published); err != nil {
+		t.Errorf("date_published of a published post = %q: %v", published, err)
+	}
+}
+
+func TestFeedNotModified(t *testing.T) {
+	s := feedTestServer(t)
+	rec := s.do(http.MethodGet, "/feed.rss", "", nil)
+	lastModified := rec.Header().Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("feed has no Last-Modified")
+	}
+
+	if rec := s.do(http.MethodGet, "/feed.rss", "", nil, "If-Modified-Since", lastModified); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with current If-Modified-Since = %d, want 304", rec.Code)
+	}
+	old := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if rec := s.do(http.MethodGet, "/feed.rss", "", nil, "If-Modified-Since", old); rec.Code != http.StatusOK {
+		t.Errorf("GET with old If-Modified-Since = %d, want 200", rec.Code)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	s := feedTestServer(t)
+	s.Config.PostURLTemplate = "https://www.blog.example/read/{id}.html"
+
+	var sitemap struct {
+		XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(getFeed(t, s, "/sitemap.xml", "application/xml"), &sitemap); err != nil {
+		t.Fatal(err)
+	}
+	if len(sitemap.URLs) != 1 {
+		t.Fatalf("sitemap has %d URLs, want 1: %+v", len(sitemap.URLs), sitemap.URLs)
+	}
+	if loc := sitemap.URLs[0].Loc; loc != "https://www.blog.example/read/1.html" {
+		t.Errorf("loc = %q, want the public post URL", loc)
+	}
+	if _, err := time.Parse(time.RFC3339, sitemap.URLs[0].LastMod); err != nil {
+		t.Errorf("lastmod is not W3C datetime: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type probeCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type migrationState struct {
+	Status  string `json:"status"`
+	Version int    `json:"version"`
+	Latest  int    `json:"latest"`
+	Search  bool   `json:"search"`
+}
+
+type readiness struct {
+	Status     string         `json:"status"`
+	Draining   bool           `json:"draining,omitempty"`
+	Database   probeCheck     `json:"database"`
+	Migrations migrationState `json:"migrations"`
+}
+
+// probePaths are left out of rate limiting, so an orchestrator or a metrics
+// scraper polling them never sees a 429.
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// getHealth is the liveness probe. It only says the process still serves
+// HTTP; a broken database must not get the pod restarted.
+func (h *Handler) getHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, probeCheck{Status: "ok"})
+}
+
+// getReadiness is the readiness probe. The instance is ready once SQLite
+// answers and the schema is current, and stops being ready when it starts
+// draining for shutdown.
+func (h *Handler) getReadiness(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readinessTimeout)
+	defer cancel()
+
+	r := readiness{Status: "ready", Draining: h.draining.Load(), Database: probeCheck{Status: "ok"}}
+
+	sqlDB, err := h.DB.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		c.Logger().Errorf("Readiness check failed to ping database: %v", err)
+		r.Database = probeCheck{Status: "unavailable", Error: err.Error()}
+	} else {
+		r.Migrations = h.migrationState(ctx)
+	}
+
+	schemaReady := r.Migrations.Status == "ok" || (r.Migrations.Status == "pending" && h.Config.AllowPendingMigrations)
+	if r.Draining || r.Database.Status != "ok" || !schemaReady {
+		r.Status = "unavailable"
+		return c.JSON(http.StatusServiceUnavailable, r)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+func (h *Handler) migrationState(ctx context.Context) migrationState {
+	db := h.DB.WithContext(ctx)
+	status, err := checkSchema(db)
+	if err != nil {
+		return migrationState{Status: "unknown"}
+	}
+	state := migrationState{Status: "ok", Version: status.Current, Latest: status.Latest, Search: db.Migrator().HasTable(postsFTSTable)}
+	if status.pending() > 0 {
+		state.Status = "pending"
+	}
+	return state
+}
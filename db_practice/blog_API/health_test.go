@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	s := newTestServer(t)
+	s.Config.RateLimits = map[string]RateLimit{rateLimitRead: {Requests: 1, Period: time.Minute, Burst: 1}}
+
+	for range 3 {
+		if rec := s.do(http.MethodGet, "/healthz", "", nil); rec.Code != http.StatusOK {
+			t.Fatalf("GET /healthz = %d", rec.Code)
+		}
+		rec := s.do(http.MethodGet, "/readyz", "", nil)
+		if got := decodeJSON[readiness](t, rec); rec.Code != http.StatusOK || got.Status != "ready" || !got.Migrations.Search {
+			t.Fatalf("GET /readyz = %d %+v, want ready without being rate limited", rec.Code, got)
+		}
+	}
+
+	s.draining.Store(true)
+	rec := s.do(http.MethodGet, "/readyz", "", nil)
+	if got := decodeJSON[readiness](t, rec); rec.Code != http.StatusServiceUnavailable || !got.Draining {
+		t.Errorf("GET /readyz while draining = %d %+v", rec.Code, got)
+	}
+	if rec := s.do(http.MethodGet, "/healthz", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /healthz while draining = %d, want 200", rec.Code)
+	}
+	s.draining.Store(false)
+
+	status, err := checkSchema(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateTo(s.DB, status.Latest-1, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+	rec = s.do(http.MethodGet, "/readyz", "", nil)
+	got := decodeJSON[readiness](t, rec)
+	if rec.Code != http.StatusServiceUnavailable || got.Migrations.Status != "pending" || got.Migrations.Version != status.Latest-1 {
+		t.Errorf("GET /readyz with a migration pending = %d %+v", rec.Code, got)
+	}
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -14,74 +23,171 @@ import (
 
 type Post struct {
 	gorm.Model
-	Title   string `json:"title" gorm:"not null"`
-	Content string `json:"content" gorm:"not null"`
+	Title       string     `json:"title" gorm:"not null" validate:"required,max=200"`
+	Slug        string     `json:"slug" gorm:"uniqueIndex"`
+	Content     string     `json:"content" gorm:"not null" validate:"required,max=100000"`
+	ContentHTML string     `json:"content_html" gorm:"not null;default:''"`
+	Excerpt     string     `json:"excerpt"`
+	ReadingTime int        `json:"reading_time_minutes"`
+	Version     uint       `json:"version" gorm:"not null;default:1"`
+	AuthorID    uint       `json:"author_id" gorm:"index"`
+	Status      string     `json:"status" gorm:"not null;default:published;index" validate:"oneof=draft scheduled published archived"`
+	PublishAt   *time.Time `json:"publish_at"`
+	PublishedAt *time.Time `json:"published_at"`
+	Tags        []Tag      `json:"tags,omitempty" gorm:"many2many:post_tags;"`
 }
 
 type Handler struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Config      *Config
+	Storage     Storage
+	RateLimiter RateLimitStore
+	Metrics     *Metrics
+	Cache       *ResponseCache
+	Stream      *PostStream
+	OutboxReady chan struct{}
+
+	draining atomic.Bool
 }
 
-func initDB() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open("blog.db"), &gorm.Config{})
+func openDB() (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open("blog.db"), &gorm.Config{})
+}
+
+// initDB opens the database and checks that its schema is current. Schema
+// changes are made by "blog_API migrate", never at startup; allowPending
+// serves an outdated schema anyway, for rolling deploys that migrate after.
+func initDB(allowPending bool) (*gorm.DB, error) {
+	db, err := openDB()
 	if err != nil {
 		return nil, err
 	}
+	if err := requireFTS5(db); err != nil {
+		return nil, err
+	}
 
-	err = db.AutoMigrate(&Post{})
+	status, err := checkSchema(db)
 	if err != nil {
 		return nil, err
 	}
+	switch {
+	case status.Current > status.Latest:
+		return nil, fmt.Errorf("database schema version %d is newer than this binary knows (%d)", status.Current, status.Latest)
+	case status.pending() > 0 && !allowPending:
+		return nil, fmt.Errorf("database schema is at version %d of %d, run \"blog_API migrate up\" first", status.Current, status.Latest)
+	case status.pending() > 0:
+		log.Printf("Serving with database schema at version %d of %d", status.Current, status.Latest)
+		return db, nil
+	}
 
-	log.Println("Database connected and migrated successfully")
+	log.Printf("Database connected at schema version %d", status.Current)
 	return db, nil
 }
 
 func (h *Handler) getAllPosts(c echo.Context) error {
-	var posts []Post
-	result := h.DB.Find(&posts)
-	if result.Error != nil {
-		c.Logger().Errorf("Database error fetching all posts: %v", result.Error)
-		return c.String(http.StatusInternalServerError, "Failed to fetch posts")
+	params, err := parsePostListParams(c)
+	if errors.Is(err, errLoginRequired) {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	lastModified, err := postsLastModified(h.DB)
+	if err != nil {
+		c.Logger().Errorf("Database error checking posts freshness: %v", err)
+		return dbError(err, "Failed to fetch posts")
+	}
+
+	posts, err := params.paginate(params.applyFilters(h.DB.Model(&Post{}).Preload("Tags")))
+	if err != nil {
+		c.Logger().Errorf("Database error fetching posts: %v", err)
+		return dbError(err, "Failed to fetch posts")
 	}
-	return c.JSON(http.StatusOK, posts)
+	return conditionalJSON(c, posts, lastModified)
 }
 
 func (h *Handler) getPostByID(c echo.Context) error {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "Invalid post ID format")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
 	}
 
 	var post Post
-	result := h.DB.First(&post, id)
+	result := h.DB.Preload("Tags").First(&post, id)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.String(http.StatusNotFound, "Post not found")
+			return echo.NewHTTPError(http.StatusNotFound, "Post not found")
 		}
 		c.Logger().Errorf("Database error fetching post %d: %v", id, result.Error)
-		return c.String(http.StatusInternalServerError, "Failed to fetch post")
+		return dbError(result.Error, "Failed to fetch post")
+	}
+
+	if !canView(currentUser(c), &post) {
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
 	}
 
+	return writePost(c, &post)
+}
+
+// writePost answers a GET of a single post, with a 304 when the client's
+// copy is current.
+func writePost(c echo.Context, post *Post) error {
+	if conditionalGET(c, postETag(post), post.UpdatedAt) {
+		return c.NoContent(http.StatusNotModified)
+	}
 	return c.JSON(http.StatusOK, post)
 }
 
 func (h *Handler) createPost(c echo.Context) error {
 	post := new(Post)
 	if err := c.Bind(post); err != nil {
-		return c.String(http.StatusBadRequest, "Invalid JSON body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
 	}
 
-	if post.Title == "" || post.Content == "" {
-		return c.String(http.StatusBadRequest, "Title and Content cannot be empty")
+	post.ID, post.Version, post.AuthorID, post.PublishedAt = 0, 1, currentUser(c).ID, nil
+	if post.Status == "" {
+		post.Status = StatusDraft
+	}
+	if err := validatePost(post); err != nil {
+		return err
+	}
+	if err := authorizeStatus(currentUser(c), nil, post); err != nil {
+		return err
 	}
 
-	result := h.DB.Create(post)
-	if result.Error != nil {
-		c.Logger().Errorf("Database error creating post: %v", result.Error)
-		return c.String(http.StatusInternalServerError, "Failed to create post")
+	tagNames, err := normalizeTags(post.Tags)
+	if err != nil {
+		return err
+	}
+
+	if err := renderPost(post); err != nil {
+		c.Logger().Errorf("Error rendering post content: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create post")
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		tags, err := resolveTags(tx, tagNames)
+		if err != nil {
+			return err
+		}
+		post.Tags = tags
+		if err := assignSlug(tx, post); err != nil {
+			return err
+		}
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		if err := recordRevision(tx, nil, post, post.AuthorID); err != nil {
+			return err
+		}
+		return enqueuePostEvents(tx, nil, post)
+	})
+	if err != nil {
+		c.Logger().Errorf("Database error creating post: %v", err)
+		return dbError(err, "Failed to create post")
 	}
 
 	return c.JSON(http.StatusCreated, post)
@@ -91,79 +197,370 @@ func (h *Handler) updatePost(c echo.Context) error {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "Invalid post ID format")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
 	}
 
 	var post Post
 	result := h.DB.First(&post, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.String(http.StatusNotFound, "Post not found")
+			return echo.NewHTTPError(http.StatusNotFound, "Post not found")
 		}
 		c.Logger().Errorf("Database error finding post %d for update: %v", id, result.Error)
-		return c.String(http.StatusInternalServerError, "Failed to find post for update")
+		return dbError(result.Error, "Failed to find post for update")
 	}
 
+	if err := authorizeOwned(currentUser(c), post.AuthorID, PermEditOwnPosts, PermEditAnyPost); err != nil {
+		return err
+	}
+	if err := h.checkIfMatch(c, &post); err != nil {
+		return err
+	}
+
+	before := post
 	if err := c.Bind(&post); err != nil {
-		return c.String(http.StatusBadRequest, "Invalid JSON body")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
 	}
+	post.ID, post.Version, post.AuthorID, post.PublishedAt = before.ID, before.Version, before.AuthorID, before.PublishedAt
 
-	if post.Title == "" || post.Content == "" {
-		return c.String(http.StatusBadRequest, "Title and Content cannot be empty")
+	if err := validatePost(&post); err != nil {
+		return err
+	}
+	if err := authorizeStatus(currentUser(c), &before, &post); err != nil {
+		return err
 	}
 
-	result = h.DB.Save(&post)
-	if result.Error != nil {
-		c.Logger().Errorf("Database error updating post %d: %v", id, result.Error)
-		return c.String(http.StatusInternalServerError, "Failed to update post")
+	// Tags are only replaced when the body mentions them.
+	var tagNames []string
+	if post.Tags != nil {
+		if tagNames, err = normalizeTags(post.Tags); err != nil {
+			return err
+		}
 	}
 
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return saveUpdatedPost(tx, &before, &post, tagNames, currentUser(c).ID)
+	})
+	if errors.Is(err, errPostGone) {
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	}
+	if errors.Is(err, errStaleVersion) {
+		return staleVersion(c)
+	}
+	if err != nil {
+		c.Logger().Errorf("Database error updating post %d: %v", id, err)
+		return dbError(err, "Failed to update post")
+	}
+
+	c.Response().Header().Set("ETag", postETag(&post))
 	return c.JSON(http.StatusOK, post)
 }
 
+func validatePost(post *Post) error {
+	if err := validate.Struct(post); err != nil {
+		return err
+	}
+	return prepareStatus(post)
+}
+
+// saveUpdatedPost writes an edited post together with its revision. Tags are
+// left alone when tagNames is nil. The UPDATE only matches the version the
+// post was read at, so a concurrent write makes it fail with errStaleVersion,
+// or errPostGone when the post was deleted meanwhile.
+func saveUpdatedPost(tx *gorm.DB, before, post *Post, tagNames []string, editorID uint) error {
+	if err := keepOrRenderPost(before, post); err != nil {
+		return err
+	}
+
+	if err := updateSlug(tx, before, post); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := tx.Model(&Post{}).Where("id = ? AND version = ?", post.ID, post.Version).Updates(map[string]any{
+		"title":        post.Title,
+		"slug":         post.Slug,
+		"content":      post.Content,
+		"content_html": post.ContentHTML,
+		"excerpt":      post.Excerpt,
+		"reading_time": post.ReadingTime,
+		"status":       post.Status,
+		"publish_at":   post.PublishAt,
+		"published_at": post.PublishedAt,
+		"version":      gorm.Expr("version + 1"),
+		"updated_at":   now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return versionMismatch(tx, post.ID)
+	}
+	post.Version++
+	post.UpdatedAt = now
+
+	if err := recordRevision(tx, before, post, editorID); err != nil {
+		return err
+	}
+	if tagNames == nil {
+		if err := tx.Model(post).Association("Tags").Find(&post.Tags); err != nil {
+			return err
+		}
+	} else {
+		tags, err := resolveTags(tx, tagNames)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(post).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+	}
+	return enqueuePostEvents(tx, before, post)
+}
+
 func (h *Handler) deletePost(c echo.Context) error {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
 	if err != nil {
-		return c.String(http.StatusBadRequest, "Invalid post ID format")
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
 	}
 
-	result := h.DB.Delete(&Post{}, id)
+	var post Post
+	if err := h.DB.Preload("Tags").First(&post, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+		}
+		c.Logger().Errorf("Database error finding post %d for delete: %v", id, err)
+		return dbError(err, "Failed to delete post")
+	}
 
-	if result.Error != nil {
-		c.Logger().Errorf("Database error deleting post %d: %v", id, result.Error)
-		return c.String(http.StatusInternalServerError, "Failed to delete post")
+	if err := authorizeOwned(currentUser(c), post.AuthorID, PermDeleteOwnPosts, PermDeleteAnyPost); err != nil {
+		return err
+	}
+	if err := h.checkIfMatch(c, &post); err != nil {
+		return err
 	}
 
-	if result.RowsAffected == 0 {
-		return c.String(http.StatusNotFound, "Post not found")
+	now := time.Now()
+	err = h.DB.Session(&gorm.Session{NowFunc: func() time.Time { return now }}).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("version = ?", post.Version).Delete(&Post{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return versionMismatch(tx, uint(id))
+		}
+		if err := deletePostComments(tx, uint(id)); err != nil {
+			return err
+		}
+		post.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+		return enqueueEvent(tx, EventPostDeleted, post.Status, &post)
+	})
+
+	switch {
+	case errors.Is(err, errPostGone):
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	case errors.Is(err, errStaleVersion):
+		return staleVersion(c)
+	case err != nil:
+		c.Logger().Errorf("Database error deleting post %d: %v", id, err)
+		return dbError(err, "Failed to delete post")
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
 func setupRoutes(e *echo.Echo, h *Handler) {
+	e.HTTPErrorHandler = h.handleError
+
+	e.Use(h.Metrics.instrument)
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 
+	// Only trust X-Forwarded-For behind a proxy, or clients could pick the IP
+	// they are rate limited by.
+	if h.Config.TrustProxy {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	e.Use(h.authenticate)
+	e.Use(h.rateLimit)
+	e.Use(h.cacheResponses)
+	e.Use(h.wakeOutbox)
+
+	auth := requireAuth
+
+	e.POST("/auth/register", h.register)
+	e.POST("/auth/login", h.login)
+	e.POST("/auth/refresh", h.refresh)
+
 	e.GET("/posts", h.getAllPosts)
+	e.GET("/posts/search", h.searchPosts)
+	e.GET("/posts/stream", h.getPostStream)
 	e.GET("/posts/:id", h.getPostByID)
-	e.POST("/posts", h.createPost)
-	e.PUT("/posts/:id", h.updatePost)
-	e.DELETE("/posts/:id", h.deletePost)
+	e.GET("/posts/by-slug/:slug", h.getPostBySlug)
+	e.POST("/posts", h.createPost, auth, requirePermission(PermCreatePosts))
+	// Edits keep the slug when only the title changes; "slug": "" derives a
+	// new one from the title, and old slugs redirect to the current one.
+	e.PUT("/posts/:id", h.updatePost, auth)
+	e.PATCH("/posts/:id", h.patchPost, auth)
+	e.DELETE("/posts/:id", h.deletePost, auth)
+
+	e.GET("/posts/:id/comments", h.getComments)
+	e.POST("/posts/:id/comments", h.createComment, auth, requirePermission(PermComment))
+	e.PUT("/posts/:id/comments/:commentID", h.updateComment, auth)
+	e.DELETE("/posts/:id/comments/:commentID", h.deleteComment, auth)
+
+	e.GET("/posts/:id/revisions", h.getRevisions, auth)
+	e.GET("/posts/:id/revisions/:rev/diff", h.diffRevision, auth)
+	e.POST("/posts/:id/revisions/:rev/restore", h.restoreRevision, auth)
+
+	e.GET("/posts/:id/attachments", h.getAttachments)
+	e.POST("/posts/:id/attachments", h.uploadAttachment, auth)
+	e.DELETE("/posts/:id/attachments/:attachmentID", h.deleteAttachment, auth)
+	e.GET("/attachments/:id", h.getAttachmentFile)
+	e.GET("/attachments/:id/thumbnail", h.getAttachmentThumbnail)
+
+	e.GET("/trash/posts", h.getTrashedPosts, auth)
+	e.POST("/trash/posts/:id/restore", h.restorePost, auth)
+	e.DELETE("/trash/posts/:id", h.purgePost, auth)
+
+	e.GET("/tags", h.getAllTags)
+	e.GET("/tags/:name/posts", h.getPostsByTag)
+
+	e.GET("/feed.rss", h.getRSSFeed)
+	e.GET("/feed.atom", h.getAtomFeed)
+	e.GET("/feed.json", h.getJSONFeed)
+	e.GET("/tags/:name/feed.rss", h.getRSSFeed)
+	e.GET("/tags/:name/feed.atom", h.getAtomFeed)
+	e.GET("/tags/:name/feed.json", h.getJSONFeed)
+	e.GET("/sitemap.xml", h.getSitemap)
+
+	e.POST("/admin/search/rebuild", h.rebuildSearch, auth, requirePermission(PermManageSite))
+	e.GET("/admin/export", h.exportPosts, auth, requirePermission(PermManageSite))
+	e.POST("/admin/import", h.importPosts, auth, requirePermission(PermManageSite))
+	e.GET("/admin/cache", h.getCacheStats, auth, requirePermission(PermManageSite))
+	e.DELETE("/admin/cache", h.purgeCache, auth, requirePermission(PermManageSite))
+
+	e.GET("/admin/users", h.getUsers, auth, requirePermission(PermManageUsers))
+	e.PUT("/admin/users/:id/role", h.updateUserRole, auth, requirePermission(PermManageUsers))
+	e.GET("/admin/roles", h.getRoles, auth, requirePermission(PermManageUsers))
+
+	e.GET("/webhooks", h.getWebhooks, auth, requirePermission(PermManageSite))
+	e.POST("/webhooks", h.createWebhook, auth, requirePermission(PermManageSite))
+	e.GET("/webhooks/:id", h.getWebhook, auth, requirePermission(PermManageSite))
+	e.PUT("/webhooks/:id", h.updateWebhook, auth, requirePermission(PermManageSite))
+	// Deleting a webhook also deletes its delivery log.
+	e.DELETE("/webhooks/:id", h.deleteWebhook, auth, requirePermission(PermManageSite))
+	e.GET("/webhooks/:id/deliveries", h.getWebhookDeliveries, auth, requirePermission(PermManageSite))
+	e.POST("/webhooks/:id/deliveries/:deliveryID/retry", h.retryDelivery, auth, requirePermission(PermManageSite))
+
+	e.GET("/healthz", h.getHealth)
+	e.GET("/readyz", h.getReadiness)
+	e.GET("/metrics", h.getMetrics)
+
+	e.GET("/openapi.json", h.getOpenAPI)
+	e.GET("/docs", h.getAPIDocs)
 }
 
 func main() {
-	db, err := initDB()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+
+	allowPending := flag.Bool("allow-pending-migrations", false, "serve even when the database schema is behind")
+	flag.Parse()
+
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to load config: %v", err)
 	}
+	cfg.AllowPendingMigrations = *allowPending
 
-	handler := &Handler{DB: db}
+	db, err := initDB(cfg.AllowPendingMigrations)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	if err := ensureAdmin(db, cfg.AdminUsername, cfg.AdminPassword); err != nil {
+		log.Fatalf("Failed to set up admin account: %v", err)
+	}
+
+	storage, err := NewLocalStorage(cfg.UploadDir)
+	if err != nil {
+		log.Fatalf("Failed to open upload storage: %v", err)
+	}
+
+	metrics, err := NewMetrics(db)
+	if err != nil {
+		log.Fatalf("Failed to set up metrics: %v", err)
+	}
+
+	cache := NewResponseCache(cfg.CacheSize)
+	metrics.observeCache(cache)
+
+	stream := NewPostStream(cfg.StreamReplay)
+	metrics.observeStream(stream)
+
+	handler := &Handler{
+		DB: db, Config: cfg, Storage: storage, RateLimiter: NewMemoryRateLimitStore(),
+		Metrics: metrics, Cache: cache, Stream: stream, OutboxReady: make(chan struct{}, 1),
+	}
 
 	e := echo.New()
 
 	setupRoutes(e, handler)
 
-	e.Logger.Fatal(e.Start(":8080"))
-}
\ No newline at end of file
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		runPublisher(ctx, db, cfg.PublishInterval, cache)
+	}()
+	go func() {
+		defer workers.Done()
+		handler.runTrashPurger(ctx, cfg.TrashRetention)
+	}()
+	deliveriesReady := make(chan struct{}, 1)
+	go func() {
+		defer workers.Done()
+		runOutboxDispatcher(ctx, db, cfg.WebhookInterval, stream, handler.OutboxReady, deliveriesReady)
+	}()
+	go func() {
+		defer workers.Done()
+		runWebhookWorker(ctx, db, cfg.WebhookInterval, deliveriesReady)
+	}()
+
+	go func() {
+		if err := e.Start(":8080"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down, draining requests for up to %s", cfg.ShutdownTimeout)
+
+	// Fail readiness first so load balancers stop sending new requests while
+	// the in-flight ones finish.
+	handler.draining.Store(true)
+	stream.Close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
+	workers.Wait()
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		}
+	}
+	log.Println("Shutdown complete")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testServer is the whole API on a fresh database.
+type testServer struct {
+	*Handler
+	e *echo.Echo
+}
+
+// openTestDB opens an empty database in a temporary directory. SQLite has
+// to be built with FTS5, so run the tests with "make test" or
+// "go test -tags sqlite_fts5".
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "blog.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := requireFTS5(db); err != nil {
+		t.Fatalf("%v: run \"make test\"", err)
+	}
+	return db
+}
+
+// newTestDB opens a database migrated to the latest version.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTestDB(t)
+	status, err := checkSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateTo(db, status.Latest, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	t.Setenv("BLOG_JWT_SECRET", "test secret")
+	t.Setenv("BLOG_BASE_URL", "https://blog.example")
+	for _, group := range []string{"AUTH", "READ", "WRITE"} {
+		t.Setenv("BLOG_RATE_LIMIT_"+group, "off")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.UploadDir = t.TempDir()
+	storage, err := NewLocalStorage(cfg.UploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newTestDB(t)
+	metrics, err := NewMetrics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewResponseCache(cfg.CacheSize)
+	metrics.observeCache(cache)
+	stream := NewPostStream(cfg.StreamReplay)
+	metrics.observeStream(stream)
+	h := &Handler{
+		DB: db, Config: cfg, Storage: storage, RateLimiter: NewMemoryRateLimitStore(),
+		Metrics: metrics, Cache: cache, Stream: stream, OutboxReady: make(chan struct{}, 1),
+	}
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	setupRoutes(e, h)
+	return &testServer{Handler: h, e: e}
+}
+
+// login creates a user with role and returns an access token for it.
+func (s *testServer) login(t *testing.T, username, role string) string {
+	t.Helper()
+	user := &User{Username: username, PasswordHash: "-", Role: role}
+	if err := s.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := s.issueTokens(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.AccessToken
+}
+
+// do sends a request through the router. body is encoded as JSON unless it
+// is already a string.
+func (s *testServer) do(method, path, token string, body any, header ...string) *httptest.ResponseRecorder {
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(b)
+	default:
+		data, _ := json.Marshal(b)
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// createPost creates a post through the API and returns it.
+func (s *testServer) createPost(t *testing.T, token string, post map[string]any) Post {
+	t.Helper()
+	rec := s.do(http.MethodPost, "/posts", token, post)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /posts = %d %s", rec.Code, rec.Body)
+	}
+	return decodeJSON[Post](t, rec)
+}
+
+func decodeJSON[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"gorm.io/gorm"
+)
+
+const (
+	excerptLength  = 200
+	wordsPerMinute = 200
+)
+
+// Code blocks are highlighted with CSS classes rather than inline styles, so
+// the frontend picks the colour theme.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.GFM,
+		highlighting.NewHighlighting(
+			highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+		),
+	),
+)
+
+var htmlPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w\- ]+$`)).OnElements("pre", "code", "span")
+	return p
+}()
+
+var textPolicy = bluemonday.StrictPolicy()
+
+// renderPost fills in the derived ContentHTML, Excerpt and ReadingTime fields
+// from the Markdown in Content.
+func renderPost(post *Post) error {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(post.Content), &buf); err != nil {
+		return err
+	}
+	post.ContentHTML = htmlPolicy.Sanitize(buf.String())
+
+	text := strings.Join(strings.Fields(html.UnescapeString(textPolicy.Sanitize(post.ContentHTML))), " ")
+	post.Excerpt = truncateWords(text, excerptLength)
+	post.ReadingTime = max(1, int(math.Ceil(float64(len(strings.Fields(text)))/wordsPerMinute)))
+	return nil
+}
+
+// keepOrRenderPost re-renders post only when its Markdown changed since before.
+func keepOrRenderPost(before, post *Post) error {
+	if before == nil || before.Content != post.Content || before.ContentHTML == "" {
+		return renderPost(post)
+	}
+	post.ContentHTML, post.Excerpt, post.ReadingTime = before.ContentHTML, before.Excerpt, before.ReadingTime
+	return nil
+}
+
+func truncateWords(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	cut := []rune(s)[:limit]
+	if i := strings.LastIndexByte(string(cut), ' '); i > 0 {
+		return string(cut)[:i] + "…"
+	}
+	return string(cut) + "…"
+}
+
+// renderMissingContent renders posts stored before Markdown rendering existed.
+func renderMissingContent(db *gorm.DB) error {
+	var posts []Post
+	return db.Unscoped().Where("content_html = ''").FindInBatches(&posts, 100, func(tx *gorm.DB, _ int) error {
+		for i := range posts {
+			if err := renderPost(&posts[i]); err != nil {
+				return err
+			}
+			err := tx.Unscoped().Model(&posts[i]).UpdateColumns(map[string]any{
+				"content_html": posts[i].ContentHTML,
+				"excerpt":      posts[i].Excerpt,
+				"reading_time": posts[i].ReadingTime,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderPost(t *testing.T) {
+	post := &Post{Content: "# Hello\n\nSome **bold** text.<img src=x onerror=alert(1)>\n\n```go\nfunc main() {}\n```\n"}
+	if err := renderPost(post); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(post.ContentHTML, "onerror") {
+		t.Errorf("ContentHTML keeps an event handler: %s", post.ContentHTML)
+	}
+	for _, want := range []string{"<h1", "<strong>bold</strong>", `<pre class="chroma">`} {
+		if !strings.Contains(post.ContentHTML, want) {
+			t.Errorf("ContentHTML lacks %s: %s", want, post.ContentHTML)
+		}
+	}
+	if post.Excerpt != "Hello Some bold text. func main() {}" || post.ReadingTime != 1 {
+		t.Errorf("excerpt %q, reading time %d", post.Excerpt, post.ReadingTime)
+	}
+
+	long := &Post{Content: strings.Repeat("word ", 450)}
+	if err := renderPost(long); err != nil {
+		t.Fatal(err)
+	}
+	if long.ReadingTime != 3 || !strings.HasSuffix(long.Excerpt, "word…") || len([]rune(long.Excerpt)) > excerptLength+1 {
+		t.Errorf("long post: excerpt %q, reading time %d", long.Excerpt, long.ReadingTime)
+	}
+}
+
+func TestRenderMissingContent(t *testing.T) {
+	db := newTestDB(t)
+	posts := []Post{{Title: "Live", Slug: "live", Content: "*live*"}, {Title: "Trashed", Slug: "trashed", Content: "*trashed*"}}
+	if err := db.Create(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&posts[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renderMissingContent(db); err != nil {
+		t.Fatal(err)
+	}
+	var rendered []Post
+	if err := db.Unscoped().Order("id").Find(&rendered).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range rendered {
+		if !strings.Contains(post.ContentHTML, "<em>") {
+			t.Errorf("%s was not rendered: %q", post.Title, post.ContentHTML)
+		}
+	}
+}
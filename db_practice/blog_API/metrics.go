@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const (
+	metricsNamespace = "blog"
+
+	// unmatchedRoute labels requests that hit no route, so scanners probing
+	// random URLs can't blow up the label set.
+	unmatchedRoute = "unmatched"
+
+	queryStartKey = "metrics:query_start"
+)
+
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Metrics holds the Prometheus collectors of the API. Routes are labeled by
+// their template, /posts/:id, and queries by operation and table, so the
+// number of series stays bounded.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	queryDuration   *prometheus.HistogramVec
+	handler         http.Handler
+}
+
+func NewMetrics(db *gorm.DB) (*Metrics, error) {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query latency by operation and table.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+		}, []string{"operation", "table"}),
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.queryDuration,
+		collectors.NewDBStatsCollector(sqlDB, "sqlite"),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+
+	if err := m.instrumentDB(db); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// instrumentDB times every GORM operation with a pair of callbacks around
+// the one that runs the SQL.
+func (m *Metrics) instrumentDB(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(queryStartKey)
+			if !ok {
+				return
+			}
+			table := tx.Statement.Table
+			if table == "" {
+				table = "none"
+			}
+			m.queryDuration.WithLabelValues(operation, table).Observe(time.Since(v.(time.Time)).Seconds())
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("metrics:before_create", before),
+		cb.Create().After("gorm:create").Register("metrics:after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", before),
+		cb.Query().After("gorm:query").Register("metrics:after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", before),
+		cb.Update().After("gorm:update").Register("metrics:after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", before),
+		cb.Row().After("gorm:row").Register("metrics:after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instrument counts and times requests. It runs outside every other
+// middleware so rate limited and failed requests are measured too.
+func (m *Metrics) instrument(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		route := c.Path()
+		if route == "" || route == "/*" {
+			route = unmatchedRoute
+		}
+		// The error handler hasn't written the response yet, so take the
+		// status it is going to use.
+		status := c.Response().Status
+		if err != nil && !c.Response().Committed {
+			status = toProblem(err).Status
+		}
+
+		method := c.Request().Method
+		if !knownMethods[method] {
+			method = "other"
+		}
+		m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (h *Handler) getMetrics(c echo.Context) error {
+	h.Metrics.handler.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// observeStream exports the clients and events of the post stream.
+func (m *Metrics) observeStream(stream *PostStream) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "stream_clients", Help: "Clients connected to the post stream."},
+			func() float64 { return float64(stream.Stats().Clients) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: metricsNamespace, Name: "stream_events_total", Help: "Events published on the post stream."},
+			func() float64 { return float64(stream.Stats().Events) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: metricsNamespace, Name: "stream_dropped_clients_total", Help: "Stream clients dropped for falling behind."},
+			func() float64 { return float64(stream.Stats().Dropped) }),
+	)
+}
+
+// observeCache exports the counters of the response cache.
+func (m *Metrics) observeCache(cache *ResponseCache) {
+	counter := func(name, help string, value func(CacheStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: metricsNamespace, Name: name, Help: help},
+			func() float64 { return float64(value(cache.Stats())) })
+	}
+	m.registry.MustRegister(
+		counter("cache_hits_total", "Responses served from the response cache.", func(s CacheStats) uint64 { return s.Hits }),
+		counter("cache_misses_total", "Cacheable requests that missed the response cache.", func(s CacheStats) uint64 { return s.Misses }),
+		counter("cache_evictions_total", "Entries evicted from the full response cache.", func(s CacheStats) uint64 { return s.Evictions }),
+		counter("cache_invalidations_total", "Purges of the response cache after writes.", func(s CacheStats) uint64 { return s.Invalidations }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: "cache_entries", Help: "Entries in the response cache."},
+			func() float64 { return float64(cache.Stats().Entries) }),
+	)
+}
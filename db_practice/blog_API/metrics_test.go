@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleEditor)
+	post := s.createPost(t, author, map[string]any{"title": "Counted", "content": "Body", "status": StatusPublished})
+	s.do(http.MethodGet, fmt.Sprintf("/posts/%d", post.ID), "", nil)
+	s.do(http.MethodGet, "/posts/99", "", nil)
+	s.do(http.MethodGet, "/posts/98", "", nil)
+	s.do(http.MethodGet, "/wp-login.php", "", nil)
+
+	rec := s.do(http.MethodGet, "/metrics", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`blog_http_requests_total{method="POST",route="/posts",status="201"} 1`,
+		`blog_http_requests_total{method="GET",route="/posts/:id",status="200"} 1`,
+		`blog_http_requests_total{method="GET",route="/posts/:id",status="404"} 2`,
+		`blog_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`blog_http_request_duration_seconds_count{method="GET",route="/posts/:id"} 3`,
+		`blog_db_query_duration_seconds_count{operation="create",table="posts"}`,
+		`blog_db_query_duration_seconds_count{operation="query",table="posts"}`,
+		"go_sql_open_connections",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(body, "wp-login") || strings.Contains(body, "/posts/99") {
+		t.Error("metrics are labeled with request paths instead of route templates")
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migrations are numbered files in migrations/, each version with an up and
+// a down script: 0002_add_post_views.up.sql and 0002_add_post_views.down.sql.
+// Versions start at 1 and have no gaps.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationBackfills fill in data that SQL can't compute, such as rendered
+// Markdown, for the rows that exist when a migration adds a column. Each runs
+// right after the up script of its version, in the same transaction.
+var migrationBackfills = map[int]func(tx *gorm.DB) error{
+	9:  renderMissingContent,
+	11: assignMissingSlugs,
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+const schemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    integer PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at datetime NOT NULL
+)`
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration is a row of schema_migrations, one per applied version.
+type SchemaMigration struct {
+	Version   int       `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// schemaStatus compares the database with the embedded migrations.
+type schemaStatus struct {
+	Current int `json:"current"`
+	Latest  int `json:"latest"`
+}
+
+func (s schemaStatus) pending() int { return s.Latest - s.Current }
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		m := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.up.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, len(byVersion))
+	for version, mig := range byVersion {
+		if version < 1 || version > len(migrations) {
+			return nil, fmt.Errorf("migration versions must run from 1 to %d without gaps, found %d", len(migrations), version)
+		}
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down script", version)
+		}
+		migrations[version-1] = *mig
+	}
+	return migrations, nil
+}
+
+// currentSchemaVersion is the latest applied migration, 0 for a database
+// that was never migrated.
+func currentSchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+func checkSchema(db *gorm.DB) (schemaStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return schemaStatus{}, err
+	}
+	current, err := currentSchemaVersion(db)
+	return schemaStatus{Current: current, Latest: len(migrations)}, err
+}
+
+// migrateTo moves the schema up or down to target one version at a time.
+// Every step runs in its own transaction together with its bookkeeping, so
+// a failed step leaves the schema at the previous version.
+func migrateTo(db *gorm.DB, target int, logf func(format string, args ...any)) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("no migration %d, versions run from 0 to %d", target, len(migrations))
+	}
+	if err := db.Exec(schemaMigrationsDDL).Error; err != nil {
+		return err
+	}
+	current, err := currentSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database is at version %d, newer than this binary knows (%d)", current, len(migrations))
+	}
+
+	for current < target {
+		mig := migrations[current]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.Up).Error; err != nil {
+				return err
+			}
+			if backfill, ok := migrationBackfills[mig.Version]; ok {
+				if err := backfill(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Create(&SchemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s up: %w", mig.Version, mig.Name, err)
+		}
+		logf("Applied migration %d %s", mig.Version, mig.Name)
+		current++
+	}
+	for current > target {
+		mig := migrations[current-1]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(mig.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, mig.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s down: %w", mig.Version, mig.Name, err)
+		}
+		logf("Reverted migration %d %s", mig.Version, mig.Name)
+		current--
+	}
+	return nil
+}
+
+const migrateUsage = `usage: blog_API migrate up|down|status|to N
+
+  up      apply all pending migrations
+  down    revert the latest migration
+  status  list migrations and whether they are applied
+  to N    migrate up or down to version N, 0 reverts everything
+`
+
+// runMigrateCommand is the "migrate" subcommand. It returns the exit code.
+func runMigrateCommand(args []string) int {
+	fset := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fset.Usage = func() { fmt.Fprint(fset.Output(), migrateUsage) }
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	args = fset.Args()
+	if len(args) == 0 {
+		fset.Usage()
+		return 2
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to database: %v\n", err)
+		return 1
+	}
+	logf := func(format string, args ...any) { fmt.Printf(format+"\n", args...) }
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		var status schemaStatus
+		if status, err = checkSchema(db); err == nil {
+			err = migrateTo(db, status.Latest, logf)
+		}
+	case args[0] == "down" && len(args) == 1:
+		var current int
+		if current, err = currentSchemaVersion(db); err == nil {
+			if current == 0 {
+				err = errors.New("no migration to revert")
+			} else {
+				err = migrateTo(db, current-1, logf)
+			}
+		}
+	case args[0] == "to" && len(args) == 2:
+		target, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			err = fmt.Errorf("invalid version %q", args[1])
+		} else {
+			err = migrateTo(db, target, logf)
+		}
+	case args[0] == "status" && len(args) == 1:
+		err = printMigrationStatus(db)
+	default:
+		fset.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(db *gorm.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	var applied []SchemaMigration
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		if err := db.Order("version").Find(&applied).Error; err != nil {
+			return err
+		}
+	}
+	appliedAt := make(map[int]time.Time, len(applied))
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, mig := range migrations {
+		state := "pending"
+		if t, ok := appliedAt[mig.Version]; ok {
+			state = t.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", mig.Version, mig.Name, state)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// baselinePost is the posts table as AutoMigrate created it before any
+// migration existed.
+type baselinePost struct {
+	gorm.Model
+	Title   string `gorm:"not null"`
+	Content string `gorm:"not null"`
+}
+
+func (baselinePost) TableName() string { return "posts" }
+
+// laterTables are created by migrations after the baseline.
+var laterTables = []string{
+	"posts_fts", "comments", "tags", "post_tags", "users", "post_revisions",
+	"attachments", "post_slugs", "webhooks", "outbox_events", "webhook_deliveries",
+}
+
+func migrateOrFail(t *testing.T, db *gorm.DB, target int) {
+	t.Helper()
+	if err := migrateTo(db, target, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&baselinePost{}); err != nil {
+		t.Fatal(err)
+	}
+	old := []baselinePost{
+		{Title: "Hello world", Content: "Some *Markdown*."},
+		{Title: "Hello world", Content: "Same title."},
+		{Title: "Gone", Content: "In the trash."},
+	}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&old[2]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := checkSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrateOrFail(t, db, status.Latest)
+
+	var posts []Post
+	if err := db.Unscoped().Order("id").Find(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != len(old) {
+		t.Fatalf("%d posts after migrating, want %d", len(posts), len(old))
+	}
+	for i, want := range []string{"hello-world", "hello-world-2", "gone"} {
+		p := posts[i]
+		if p.Slug != want {
+			t.Errorf("post %d slug = %q, want %q", p.ID, p.Slug, want)
+		}
+		if p.Status != StatusPublished || p.PublishedAt == nil || p.Version != 1 {
+			t.Errorf("post %d status = %q, published_at = %v, version = %d, want published at version 1", p.ID, p.Status, p.PublishedAt, p.Version)
+		}
+		if p.ContentHTML == "" || p.Excerpt == "" || p.ReadingTime < 1 {
+			t.Errorf("post %d was not rendered: %+v", p.ID, p)
+		}
+	}
+	var hits []uint
+	if err := db.Raw("SELECT rowid FROM posts_fts WHERE posts_fts MATCH ?", "markdown").Scan(&hits).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(hits, []uint{posts[0].ID}) {
+		t.Errorf("search for existing posts = %v, want [%d]", hits, posts[0].ID)
+	}
+
+	// Every down script must undo its up script on a database with data.
+	for version := status.Latest; version > 1; version-- {
+		migrateOrFail(t, db, version-1)
+		migrateOrFail(t, db, version)
+		migrateOrFail(t, db, version-1)
+	}
+
+	columns, err := db.Migrator().ColumnTypes("posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, col := range columns {
+		names = append(names, col.Name())
+	}
+	if want := []string{"id", "created_at", "updated_at", "deleted_at", "title", "content"}; !slices.Equal(names, want) {
+		t.Errorf("posts columns at version 1 = %v, want the baseline %v", names, want)
+	}
+	for _, table := range laterTables {
+		if db.Migrator().HasTable(table) {
+			t.Errorf("table %s is left at version 1", table)
+		}
+	}
+	var count int64
+	if err := db.Unscoped().Model(&baselinePost{}).Count(&count).Error; err != nil || count != int64(len(old)) {
+		t.Errorf("%d posts at version 1 (%v), want %d", count, err, len(old))
+	}
+
+	migrateOrFail(t, db, 0)
+	if db.Migrator().HasTable("posts") {
+		t.Error("posts is left at version 0")
+	}
+	if current, err := currentSchemaVersion(db); err != nil || current != 0 {
+		t.Errorf("schema version = %d, %v, want 0", current, err)
+	}
+}
@@ -0,0 +1,12 @@
+-- The posts table as AutoMigrate created it before versioned migrations.
+-- IF NOT EXISTS lets those databases adopt it unchanged.
+
+CREATE TABLE IF NOT EXISTS posts (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    title      text NOT NULL,
+    content    text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts(deleted_at);
@@ -0,0 +1,15 @@
+CREATE TABLE comments (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    post_id    integer NOT NULL,
+    parent_id  integer,
+    user_id    integer,
+    author     text,
+    content    text NOT NULL
+);
+CREATE INDEX idx_comments_user_id ON comments(user_id);
+CREATE INDEX idx_comments_parent_id ON comments(parent_id);
+CREATE INDEX idx_comments_post_id ON comments(post_id);
+CREATE INDEX idx_comments_deleted_at ON comments(deleted_at);
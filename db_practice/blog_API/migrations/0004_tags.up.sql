@@ -0,0 +1,13 @@
+CREATE TABLE tags (
+    id   integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL
+);
+CREATE UNIQUE INDEX idx_tags_name ON tags(name);
+
+CREATE TABLE post_tags (
+    post_id integer,
+    tag_id  integer,
+    PRIMARY KEY (post_id, tag_id),
+    CONSTRAINT fk_post_tags_post FOREIGN KEY (post_id) REFERENCES posts(id),
+    CONSTRAINT fk_post_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_author_id;
+ALTER TABLE posts DROP COLUMN author_id;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,16 @@
+-- Posts written before accounts existed have no author.
+
+CREATE TABLE users (
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    created_at    datetime,
+    updated_at    datetime,
+    deleted_at    datetime,
+    username      text NOT NULL,
+    password_hash text NOT NULL,
+    role          text NOT NULL DEFAULT 'author'
+);
+CREATE UNIQUE INDEX idx_users_username ON users(username);
+CREATE INDEX idx_users_deleted_at ON users(deleted_at);
+
+ALTER TABLE posts ADD COLUMN author_id integer;
+CREATE INDEX idx_posts_author_id ON posts(author_id);
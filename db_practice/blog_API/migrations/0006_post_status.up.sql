@@ -0,0 +1,8 @@
+-- Existing posts were all live, so they are published as of their creation.
+
+ALTER TABLE posts ADD COLUMN status text NOT NULL DEFAULT 'published';
+ALTER TABLE posts ADD COLUMN publish_at datetime;
+ALTER TABLE posts ADD COLUMN published_at datetime;
+CREATE INDEX idx_posts_status ON posts(status);
+
+UPDATE posts SET published_at = created_at WHERE published_at IS NULL;
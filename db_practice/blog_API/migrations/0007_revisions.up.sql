@@ -0,0 +1,10 @@
+CREATE TABLE post_revisions (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    post_id    integer NOT NULL,
+    revision   integer NOT NULL,
+    title      text,
+    content    text,
+    editor_id  integer,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_post_revision ON post_revisions(post_id, revision);
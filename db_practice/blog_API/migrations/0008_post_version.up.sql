@@ -0,0 +1 @@
+ALTER TABLE posts ADD COLUMN version integer NOT NULL DEFAULT 1;
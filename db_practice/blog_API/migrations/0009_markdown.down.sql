@@ -0,0 +1,3 @@
+ALTER TABLE posts DROP COLUMN reading_time;
+ALTER TABLE posts DROP COLUMN excerpt;
+ALTER TABLE posts DROP COLUMN content_html;
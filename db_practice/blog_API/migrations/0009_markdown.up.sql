@@ -0,0 +1,6 @@
+-- The rendered HTML, excerpt and reading time of existing posts are filled
+-- in by renderMissingContent, which runs after this script.
+
+ALTER TABLE posts ADD COLUMN content_html text NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN excerpt text;
+ALTER TABLE posts ADD COLUMN reading_time integer;
@@ -0,0 +1,15 @@
+CREATE TABLE attachments (
+    id                     integer PRIMARY KEY AUTOINCREMENT,
+    post_id                integer NOT NULL,
+    uploader_id            integer,
+    filename               text NOT NULL,
+    content_type           text NOT NULL,
+    size                   integer,
+    width                  integer,
+    height                 integer,
+    storage_key            text NOT NULL,
+    thumbnail_key          text,
+    thumbnail_content_type text,
+    created_at             datetime
+);
+CREATE INDEX idx_attachments_post_id ON attachments(post_id);
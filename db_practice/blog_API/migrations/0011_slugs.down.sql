@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_slugs;
+DROP INDEX IF EXISTS idx_posts_slug;
+ALTER TABLE posts DROP COLUMN slug;
@@ -0,0 +1,14 @@
+-- Existing posts get a slug from their title from assignMissingSlugs, which
+-- runs after this script.
+
+ALTER TABLE posts ADD COLUMN slug text;
+CREATE UNIQUE INDEX idx_posts_slug ON posts(slug);
+
+CREATE TABLE post_slugs (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    post_id    integer NOT NULL,
+    slug       text NOT NULL,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_post_slugs_slug ON post_slugs(slug);
+CREATE INDEX idx_post_slugs_post_id ON post_slugs(post_id);
@@ -0,0 +1,38 @@
+CREATE TABLE webhooks (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    url        text NOT NULL,
+    events     text,
+    secret     text NOT NULL,
+    active     numeric NOT NULL,
+    created_at datetime,
+    updated_at datetime
+);
+
+CREATE TABLE outbox_events (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    event_id   text NOT NULL,
+    event      text NOT NULL,
+    post_id    integer,
+    payload    text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_outbox_events_post_id ON outbox_events(post_id);
+CREATE UNIQUE INDEX idx_outbox_events_event_id ON outbox_events(event_id);
+
+CREATE TABLE webhook_deliveries (
+    id               integer PRIMARY KEY AUTOINCREMENT,
+    webhook_id       integer NOT NULL,
+    event_id         text NOT NULL,
+    event            text NOT NULL,
+    payload          text NOT NULL,
+    status           text NOT NULL,
+    attempts         integer,
+    next_attempt_at  datetime,
+    last_status_code integer,
+    last_error       text,
+    delivered_at     datetime,
+    created_at       datetime,
+    updated_at       datetime
+);
+CREATE INDEX idx_delivery_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
@@ -0,0 +1,603 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const apiVersion = "1.0.0"
+
+// Access levels of an operation. They decide the security requirement shown
+// in the document.
+const (
+	accessPublic = ""
+	accessUser   = "user"
+)
+
+// Permissions checked on posts and comments: the owner needs the first one,
+// everybody else the second, see authorizeOwned.
+var (
+	needsEditPost      = []Permission{PermEditOwnPosts, PermEditAnyPost}
+	needsDeletePost    = []Permission{PermDeleteOwnPosts, PermDeleteAnyPost}
+	needsManageComment = []Permission{PermComment, PermModerateComments}
+	needsManageSite    = []Permission{PermManageSite}
+	needsManageUsers   = []Permission{PermManageUsers}
+)
+
+// apiOperation documents one route. Every route registered in setupRoutes
+// needs an entry here, and its query parameters, body and statuses must match
+// the handler; TestAPIDocsMatchRoutes and TestAPIDocsMatchHandlers check both.
+type apiOperation struct {
+	Method   string
+	Path     string // in Echo syntax, /posts/:id
+	Handler  string // name of the Handler method serving the route
+	ID       string // operationId, defaults to Handler
+	Tag      string
+	Summary  string
+	Details  string
+	Access   string
+	Needs    []Permission // any one of them, listed in the description
+	Publish  bool         // a published or scheduled status also needs PermPublishPosts
+	Query    []apiParam
+	Headers  []apiParam
+	Body     []apiContent
+	Status   int
+	Response []apiContent
+	Other    map[int]string // responses without a body besides errors
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Schema      map[string]any
+}
+
+// apiContent is a body in one media type. Value is either a schema or a Go
+// value whose type is turned into one.
+type apiContent struct {
+	Type  string
+	Value any
+}
+
+// jsonPatchOp is one operation of an RFC 6902 JSON Patch.
+type jsonPatchOp struct {
+	Op    string `json:"op" validate:"required,oneof=add remove replace move copy test"`
+	Path  string `json:"path" validate:"required"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+var (
+	stringSchema  = map[string]any{"type": "string"}
+	integerSchema = map[string]any{"type": "integer"}
+	binarySchema  = map[string]any{"type": "string", "contentMediaType": "application/octet-stream"}
+)
+
+func jsonContent(v any) []apiContent {
+	return []apiContent{{Type: echo.MIMEApplicationJSON, Value: v}}
+}
+
+func enumSchema(values ...string) map[string]any {
+	return map[string]any{"type": "string", "enum": values}
+}
+
+var limitParam = apiParam{Name: "limit", Description: "Page size, 1 to " + strconv.Itoa(maxPageLimit), Schema: map[string]any{"type": "integer", "minimum": 1, "maximum": maxPageLimit, "default": defaultPageLimit}}
+
+var postListQuery = []apiParam{
+	limitParam,
+	{Name: "cursor", Description: "Opaque cursor from a previous page", Schema: stringSchema},
+	{Name: "sort", Schema: enumSchema("created_at", "updated_at", "title")},
+	{Name: "order", Schema: enumSchema("asc", "desc")},
+	{Name: "created_after", Description: "RFC 3339 timestamp", Schema: map[string]any{"type": "string", "format": "date-time"}},
+	{Name: "created_before", Description: "RFC 3339 timestamp", Schema: map[string]any{"type": "string", "format": "date-time"}},
+	{Name: "title_contains", Schema: stringSchema},
+	{Name: "tag", Description: "Repeat to filter by several tags", Schema: map[string]any{"type": "array", "items": stringSchema}},
+	{Name: "tag_mode", Schema: enumSchema("any", "all")},
+	{Name: "include", Description: "Also list the caller's own drafts", Schema: enumSchema("drafts")},
+	{Name: "status", Schema: enumSchema(StatusDraft, StatusScheduled, StatusPublished, StatusArchived)},
+}
+
+var ifMatchHeader = apiParam{Name: "If-Match", Description: "ETag of the post as it was read", Schema: stringSchema}
+
+// slugDetails describes how edits treat the slug.
+const slugDetails = "Changing only the title keeps the slug, so links don't break. " +
+	"Send \"slug\": \"\" to derive a new slug from the title; old slugs keep redirecting to the current one."
+
+var conditionalHeaders = []apiParam{
+	{Name: "If-None-Match", Description: "ETag of the cached copy", Schema: stringSchema},
+	{Name: "If-Modified-Since", Description: "Last-Modified of the cached copy", Schema: stringSchema},
+}
+
+var notModified304 = map[int]string{http.StatusNotModified: "The cached copy is current"}
+
+var feedModified = map[int]string{http.StatusNotModified: "Not modified since If-Modified-Since"}
+
+var fileRanges = map[int]string{
+	http.StatusPartialContent: "The part asked for with Range",
+	http.StatusNotModified:    "Not modified since If-None-Match or If-Modified-Since",
+}
+
+var apiOperations = []apiOperation{
+	{Method: http.MethodPost, Path: "/auth/register", Handler: "register", Tag: "auth", Summary: "Register a user account",
+		Body: jsonContent(credentials{}), Status: http.StatusCreated, Response: jsonContent(User{})},
+	{Method: http.MethodPost, Path: "/auth/login", Handler: "login", Tag: "auth", Summary: "Log in with username and password",
+		Body: jsonContent(credentials{}), Status: http.StatusOK, Response: jsonContent(tokenResponse{})},
+	{Method: http.MethodPost, Path: "/auth/refresh", Handler: "refresh", Tag: "auth", Summary: "Exchange a refresh token for new tokens",
+		Body: jsonContent(refreshInput{}), Status: http.StatusOK, Response: jsonContent(tokenResponse{})},
+
+	{Method: http.MethodGet, Path: "/posts", Handler: "getAllPosts", Tag: "posts", Summary: "List posts",
+		Query: postListQuery, Headers: conditionalHeaders, Status: http.StatusOK, Response: jsonContent(page[Post]{}), Other: notModified304},
+	{Method: http.MethodGet, Path: "/posts/search", Handler: "searchPosts", Tag: "posts", Summary: "Search published posts",
+		Query: []apiParam{
+			{Name: "q", Description: "Search terms, \"quoted phrases\" and prefix*", Schema: stringSchema},
+			limitParam,
+			{Name: "offset", Schema: map[string]any{"type": "integer", "minimum": 0}},
+		},
+		Status: http.StatusOK, Response: jsonContent([]searchResult{})},
+	{Method: http.MethodGet, Path: "/posts/stream", Handler: "getPostStream", Tag: "posts", Summary: "Stream post changes as Server-Sent Events",
+		Headers: []apiParam{{Name: "Last-Event-ID", Description: "Resume after this event; a reset event means it is too old", Schema: stringSchema}},
+		Status:  http.StatusOK, Response: []apiContent{{Type: "text/event-stream", Value: streamData{}}}},
+	{Method: http.MethodGet, Path: "/posts/:id", Handler: "getPostByID", Tag: "posts", Summary: "Get a post",
+		Headers: conditionalHeaders, Status: http.StatusOK, Response: jsonContent(Post{}), Other: notModified304},
+	{Method: http.MethodGet, Path: "/posts/by-slug/:slug", Handler: "getPostBySlug", Tag: "posts", Summary: "Get a post by slug",
+		Headers: conditionalHeaders, Status: http.StatusOK, Response: jsonContent(Post{}),
+		Other: map[int]string{
+			http.StatusMovedPermanently: "The slug is an old one, Location has the current one",
+			http.StatusNotModified:      "The cached copy is current",
+		}},
+	{Method: http.MethodPost, Path: "/posts", Handler: "createPost", Tag: "posts", Summary: "Create a post", Access: accessUser, Needs: []Permission{PermCreatePosts}, Publish: true,
+		Body: jsonContent(Post{}), Status: http.StatusCreated, Response: jsonContent(Post{})},
+	{Method: http.MethodPut, Path: "/posts/:id", Handler: "updatePost", Tag: "posts", Summary: "Replace a post", Details: slugDetails, Access: accessUser, Needs: needsEditPost, Publish: true,
+		Headers: []apiParam{ifMatchHeader}, Body: jsonContent(Post{}), Status: http.StatusOK, Response: jsonContent(Post{})},
+	{Method: http.MethodPatch, Path: "/posts/:id", Handler: "patchPost", Tag: "posts", Summary: "Patch a post", Details: slugDetails, Access: accessUser, Needs: needsEditPost, Publish: true,
+		Headers: []apiParam{ifMatchHeader},
+		Body: []apiContent{
+			{Type: mimeMergePatch, Value: postDocument{}},
+			{Type: mimeJSONPatch, Value: []jsonPatchOp{}},
+		},
+		Status: http.StatusOK, Response: jsonContent(Post{})},
+	{Method: http.MethodDelete, Path: "/posts/:id", Handler: "deletePost", Tag: "posts", Summary: "Move a post to the trash", Access: accessUser, Needs: needsDeletePost,
+		Headers: []apiParam{ifMatchHeader}, Status: http.StatusNoContent},
+
+	{Method: http.MethodGet, Path: "/posts/:id/comments", Handler: "getComments", Tag: "comments", Summary: "List comment threads of a post",
+		Query: []apiParam{
+			limitParam,
+			{Name: "depth", Schema: map[string]any{"type": "integer", "minimum": 1, "maximum": maxCommentDepth, "default": defaultCommentDepth}},
+			{Name: "cursor", Schema: stringSchema},
+		},
+		Status: http.StatusOK, Response: jsonContent(page[*Comment]{})},
+	{Method: http.MethodPost, Path: "/posts/:id/comments", Handler: "createComment", Tag: "comments", Summary: "Comment on a post", Access: accessUser, Needs: []Permission{PermComment},
+		Body: jsonContent(Comment{}), Status: http.StatusCreated, Response: jsonContent(Comment{})},
+	{Method: http.MethodPut, Path: "/posts/:id/comments/:commentID", Handler: "updateComment", Tag: "comments", Summary: "Edit a comment", Access: accessUser, Needs: needsManageComment,
+		Body: jsonContent(commentInput{}), Status: http.StatusOK, Response: jsonContent(Comment{})},
+	{Method: http.MethodDelete, Path: "/posts/:id/comments/:commentID", Handler: "deleteComment", Tag: "comments", Summary: "Delete a comment and its replies", Access: accessUser, Needs: needsManageComment,
+		Status: http.StatusNoContent},
+
+	{Method: http.MethodGet, Path: "/posts/:id/revisions", Handler: "getRevisions", Tag: "revisions", Summary: "List revisions of a post", Access: accessUser, Needs: needsEditPost,
+		Status: http.StatusOK, Response: jsonContent([]PostRevision{})},
+	{Method: http.MethodGet, Path: "/posts/:id/revisions/:rev/diff", Handler: "diffRevision", Tag: "revisions", Summary: "Diff a revision against another", Access: accessUser, Needs: needsEditPost,
+		Query:  []apiParam{{Name: "against", Description: "Revision to diff against, the previous one by default", Schema: integerSchema}},
+		Status: http.StatusOK, Response: []apiContent{{Type: "text/x-diff", Value: stringSchema}}},
+	{Method: http.MethodPost, Path: "/posts/:id/revisions/:rev/restore", Handler: "restoreRevision", Tag: "revisions", Summary: "Restore a revision", Access: accessUser, Needs: needsEditPost,
+		Status: http.StatusOK, Response: jsonContent(Post{})},
+
+	{Method: http.MethodGet, Path: "/posts/:id/attachments", Handler: "getAttachments", Tag: "attachments", Summary: "List attachments of a post",
+		Status: http.StatusOK, Response: jsonContent([]Attachment{})},
+	{Method: http.MethodPost, Path: "/posts/:id/attachments", Handler: "uploadAttachment", Tag: "attachments", Summary: "Upload an attachment", Access: accessUser, Needs: needsEditPost,
+		Body: []apiContent{{Type: echo.MIMEMultipartForm, Value: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"file": binarySchema},
+			"required":   []string{"file"},
+		}}},
+		Status: http.StatusCreated, Response: jsonContent(Attachment{})},
+	{Method: http.MethodDelete, Path: "/posts/:id/attachments/:attachmentID", Handler: "deleteAttachment", Tag: "attachments", Summary: "Delete an attachment", Access: accessUser, Needs: needsEditPost,
+		Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/attachments/:id", Handler: "getAttachmentFile", Tag: "attachments", Summary: "Download an attachment",
+		Status: http.StatusOK, Response: []apiContent{{Type: "*/*", Value: binarySchema}}, Other: fileRanges},
+	{Method: http.MethodGet, Path: "/attachments/:id/thumbnail", Handler: "getAttachmentThumbnail", Tag: "attachments", Summary: "Download the thumbnail of an image",
+		Status: http.StatusOK, Response: []apiContent{{Type: "image/*", Value: binarySchema}}, Other: fileRanges},
+
+	{Method: http.MethodGet, Path: "/trash/posts", Handler: "getTrashedPosts", Tag: "trash", Summary: "List trashed posts", Access: accessUser,
+		Status: http.StatusOK, Response: jsonContent([]Post{})},
+	{Method: http.MethodPost, Path: "/trash/posts/:id/restore", Handler: "restorePost", Tag: "trash", Summary: "Restore a trashed post", Access: accessUser, Needs: needsDeletePost,
+		Status: http.StatusOK, Response: jsonContent(Post{})},
+	{Method: http.MethodDelete, Path: "/trash/posts/:id", Handler: "purgePost", Tag: "trash", Summary: "Delete a trashed post for good", Access: accessUser, Needs: needsDeletePost,
+		Status: http.StatusNoContent},
+
+	{Method: http.MethodGet, Path: "/tags", Handler: "getAllTags", Tag: "tags", Summary: "List tags with their post counts",
+		Status: http.StatusOK, Response: jsonContent([]tagCount{})},
+	{Method: http.MethodGet, Path: "/tags/:name/posts", Handler: "getPostsByTag", Tag: "tags", Summary: "List posts with a tag",
+		Query: postListQuery, Status: http.StatusOK, Response: jsonContent(page[Post]{})},
+
+	{Method: http.MethodGet, Path: "/feed.rss", Handler: "getRSSFeed", Tag: "feeds", Summary: "RSS 2.0 feed",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/rss+xml", Value: stringSchema}}, Other: feedModified},
+	{Method: http.MethodGet, Path: "/feed.atom", Handler: "getAtomFeed", Tag: "feeds", Summary: "Atom feed",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/atom+xml", Value: stringSchema}}, Other: feedModified},
+	{Method: http.MethodGet, Path: "/feed.json", Handler: "getJSONFeed", Tag: "feeds", Summary: "JSON Feed",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/feed+json", Value: jsonFeed{}}}, Other: feedModified},
+	{Method: http.MethodGet, Path: "/tags/:name/feed.rss", Handler: "getRSSFeed", ID: "getTagRSSFeed", Tag: "feeds", Summary: "RSS 2.0 feed of a tag",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/rss+xml", Value: stringSchema}}, Other: feedModified},
+	{Method: http.MethodGet, Path: "/tags/:name/feed.atom", Handler: "getAtomFeed", ID: "getTagAtomFeed", Tag: "feeds", Summary: "Atom feed of a tag",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/atom+xml", Value: stringSchema}}, Other: feedModified},
+	{Method: http.MethodGet, Path: "/tags/:name/feed.json", Handler: "getJSONFeed", ID: "getTagJSONFeed", Tag: "feeds", Summary: "JSON Feed of a tag",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/feed+json", Value: jsonFeed{}}}, Other: feedModified},
+	{Method: http.MethodGet, Path: "/sitemap.xml", Handler: "getSitemap", Tag: "feeds", Summary: "Sitemap of published posts",
+		Status: http.StatusOK, Response: []apiContent{{Type: "application/xml", Value: stringSchema}}, Other: feedModified},
+
+	{Method: http.MethodPost, Path: "/admin/search/rebuild", Handler: "rebuildSearch", Tag: "admin", Summary: "Rebuild the full-text index", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/admin/export", Handler: "exportPosts", Tag: "admin", Summary: "Export all posts", Access: accessUser, Needs: needsManageSite,
+		Query:  []apiParam{{Name: "format", Schema: enumSchema("jsonl", "zip")}},
+		Status: http.StatusOK, Response: []apiContent{{Type: mimeJSONLines, Value: archivedPost{}}, {Type: mimeZip, Value: binarySchema}}},
+	{Method: http.MethodPost, Path: "/admin/import", Handler: "importPosts", Tag: "admin", Summary: "Import posts, matched by slug", Access: accessUser, Needs: needsManageSite, Publish: true,
+		Query:  []apiParam{{Name: "dry_run", Description: "Validate without saving", Schema: map[string]any{"type": "boolean"}}},
+		Body:   []apiContent{{Type: mimeJSONLines, Value: archivedPost{}}, {Type: mimeZip, Value: binarySchema}},
+		Status: http.StatusOK, Response: jsonContent(importReport{})},
+
+	{Method: http.MethodGet, Path: "/admin/cache", Handler: "getCacheStats", Tag: "admin", Summary: "Response cache statistics", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusOK, Response: jsonContent(CacheStats{})},
+	{Method: http.MethodDelete, Path: "/admin/cache", Handler: "purgeCache", Tag: "admin", Summary: "Empty the response cache", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusNoContent},
+
+	{Method: http.MethodGet, Path: "/admin/users", Handler: "getUsers", Tag: "admin", Summary: "List users with their roles", Access: accessUser, Needs: needsManageUsers,
+		Status: http.StatusOK, Response: jsonContent([]User{})},
+	{Method: http.MethodPut, Path: "/admin/users/:id/role", Handler: "updateUserRole", Tag: "admin", Summary: "Assign a role to a user", Access: accessUser, Needs: needsManageUsers,
+		Body: jsonContent(roleInput{}), Status: http.StatusOK, Response: jsonContent(User{})},
+	{Method: http.MethodGet, Path: "/admin/roles", Handler: "getRoles", Tag: "admin", Summary: "Permissions of every role", Access: accessUser, Needs: needsManageUsers,
+		Status: http.StatusOK, Response: jsonContent([]roleInfo{})},
+
+	{Method: http.MethodGet, Path: "/webhooks", Handler: "getWebhooks", Tag: "webhooks", Summary: "List webhooks", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusOK, Response: jsonContent([]Webhook{})},
+	{Method: http.MethodPost, Path: "/webhooks", Handler: "createWebhook", Tag: "webhooks", Summary: "Subscribe a webhook", Access: accessUser, Needs: needsManageSite,
+		Body: jsonContent(webhookInput{}), Status: http.StatusCreated, Response: jsonContent(Webhook{})},
+	{Method: http.MethodGet, Path: "/webhooks/:id", Handler: "getWebhook", Tag: "webhooks", Summary: "Get a webhook", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusOK, Response: jsonContent(Webhook{})},
+	{Method: http.MethodPut, Path: "/webhooks/:id", Handler: "updateWebhook", Tag: "webhooks", Summary: "Update a webhook", Access: accessUser, Needs: needsManageSite,
+		Body: jsonContent(webhookInput{}), Status: http.StatusOK, Response: jsonContent(Webhook{})},
+	{Method: http.MethodDelete, Path: "/webhooks/:id", Handler: "deleteWebhook", Tag: "webhooks", Summary: "Delete a webhook and its delivery log", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/webhooks/:id/deliveries", Handler: "getWebhookDeliveries", Tag: "webhooks", Summary: "Delivery log of a webhook, newest first", Access: accessUser, Needs: needsManageSite,
+		Query: []apiParam{
+			limitParam,
+			{Name: "status", Schema: enumSchema(DeliveryPending, DeliverySucceeded, DeliveryDead)},
+			{Name: "before", Description: "Only deliveries with a smaller ID", Schema: integerSchema},
+		},
+		Status: http.StatusOK, Response: jsonContent([]WebhookDelivery{})},
+	{Method: http.MethodPost, Path: "/webhooks/:id/deliveries/:deliveryID/retry", Handler: "retryDelivery", Tag: "webhooks", Summary: "Queue a dead or failed delivery again", Access: accessUser, Needs: needsManageSite,
+		Status: http.StatusAccepted, Response: jsonContent(WebhookDelivery{})},
+
+	{Method: http.MethodGet, Path: "/healthz", Handler: "getHealth", Tag: "probes", Summary: "Liveness probe",
+		Status: http.StatusOK, Response: jsonContent(probeCheck{})},
+	{Method: http.MethodGet, Path: "/readyz", Handler: "getReadiness", Tag: "probes", Summary: "Readiness probe",
+		Status: http.StatusOK, Response: jsonContent(readiness{}),
+		Other: map[int]string{http.StatusServiceUnavailable: "Not ready or draining, with the same body as 200"}},
+	{Method: http.MethodGet, Path: "/metrics", Handler: "getMetrics", Tag: "probes", Summary: "Prometheus metrics",
+		Status: http.StatusOK, Response: []apiContent{{Type: "text/plain", Value: stringSchema}}},
+
+	{Method: http.MethodGet, Path: "/openapi.json", Handler: "getOpenAPI", Tag: "docs", Summary: "This document",
+		Status: http.StatusOK, Response: jsonContent(map[string]any{"type": "object"})},
+	{Method: http.MethodGet, Path: "/docs", Handler: "getAPIDocs", Tag: "docs", Summary: "Browsable docs for this document",
+		Status: http.StatusOK, Response: []apiContent{{Type: echo.MIMETextHTML, Value: stringSchema}}},
+}
+
+// Types whose JSON encoding differs from what reflection shows.
+var knownSchemas = map[reflect.Type]map[string]any{
+	reflect.TypeFor[time.Time]():      {"type": "string", "format": "date-time"},
+	reflect.TypeFor[gorm.DeletedAt](): {"type": []string{"string", "null"}, "format": "date-time"},
+	reflect.TypeFor[Tag]():            {"type": "string"},
+}
+
+// schemaBuilder turns Go types into JSON Schemas, collecting named structs
+// as components.
+type schemaBuilder struct {
+	components map[string]any
+}
+
+func (b *schemaBuilder) content(contents []apiContent) map[string]any {
+	out := make(map[string]any, len(contents))
+	for _, ct := range contents {
+		schema, ok := ct.Value.(map[string]any)
+		if !ok {
+			schema = b.schema(reflect.TypeOf(ct.Value))
+		}
+		out[ct.Type] = map[string]any{"schema": schema}
+	}
+	return out
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	if s, ok := knownSchemas[t]; ok {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		if typ, ok := s["type"].(string); ok {
+			nullable := make(map[string]any, len(s))
+			for k, v := range s {
+				nullable[k] = v
+			}
+			nullable["type"] = []string{typ, "null"}
+			return nullable
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name := componentName(t)
+		if _, ok := b.components[name]; !ok {
+			// Reserve the name first, so recursive types end in a $ref.
+			b.components[name] = nil
+			b.components[name] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	b.fields(t, properties, &required)
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// fields adds the JSON fields of struct t, following embedded structs the
+// way encoding/json does.
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.fields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := b.schema(f.Type)
+		if rules := f.Tag.Get("validate"); rules != "" {
+			s = applyValidation(s, rules)
+			if slices.Contains(strings.Split(rules, ","), "required") {
+				*required = append(*required, name)
+			}
+		}
+		properties[name] = s
+	}
+}
+
+// applyValidation copies the validator rules that JSON Schema can express
+// into s. Rules after "dive" apply to the items of a slice.
+func applyValidation(s map[string]any, rules string) map[string]any {
+	out := make(map[string]any, len(s)+2)
+	for k, v := range s {
+		out[k] = v
+	}
+
+	field, items, dive := strings.Cut(rules, ",dive")
+	if strings.HasPrefix(rules, "dive") {
+		field, items, dive = "", strings.TrimPrefix(rules, "dive"), true
+	}
+	if dive {
+		if itemSchema, ok := out["items"].(map[string]any); ok {
+			out["items"] = applyValidation(itemSchema, strings.TrimPrefix(items, ","))
+		}
+	}
+
+	minKey, maxKey := "minLength", "maxLength"
+	if out["type"] == "array" {
+		minKey, maxKey = "minItems", "maxItems"
+	}
+	for _, rule := range strings.Split(field, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "max":
+			if n, err := strconv.Atoi(param); err == nil {
+				out[maxKey] = n
+			}
+		case "min":
+			if n, err := strconv.Atoi(param); err == nil {
+				out[minKey] = n
+			}
+		case "oneof":
+			out["enum"] = strings.Fields(param)
+		case "http_url":
+			out["format"] = "uri"
+		}
+	}
+	return out
+}
+
+// componentName turns Go type names into schema names: tagCount becomes
+// TagCount and page[main.Post] becomes PostPage.
+func componentName(t reflect.Type) string {
+	name, args, generic := strings.Cut(t.Name(), "[")
+	name = exportedName(name)
+	if !generic {
+		return name
+	}
+	var prefix string
+	for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), ",") {
+		arg = strings.TrimLeft(arg, "*[]")
+		if i := strings.LastIndexByte(arg, '.'); i >= 0 {
+			arg = arg[i+1:]
+		}
+		prefix += exportedName(arg)
+	}
+	return prefix + name
+}
+
+func exportedName(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+// openAPIPath turns /posts/:id into /posts/{id}.
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, seg := range segments {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			segments[i] = "{" + name + "}"
+			params = append(params, name)
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (op *apiOperation) operationID() string {
+	if op.ID != "" {
+		return op.ID
+	}
+	return op.Handler
+}
+
+func (h *Handler) openAPIDocument() map[string]any {
+	b := &schemaBuilder{components: make(map[string]any)}
+	problem := map[string]any{
+		"description": "Error, as RFC 7807 problem details",
+		"content":     map[string]any{mimeProblem: map[string]any{"schema": b.schema(reflect.TypeFor[Problem]())}},
+	}
+
+	paths := make(map[string]map[string]any)
+	for i := range apiOperations {
+		op := &apiOperations[i]
+		path, pathParams := openAPIPath(op.Path)
+
+		var params []map[string]any
+		for _, name := range pathParams {
+			schema := integerSchema
+			if name == "slug" || name == "name" {
+				schema = stringSchema
+			}
+			params = append(params, map[string]any{"name": name, "in": "path", "required": true, "schema": schema})
+		}
+		for _, p := range op.Query {
+			params = append(params, map[string]any{"name": p.Name, "in": "query", "description": p.Description, "schema": p.Schema})
+		}
+		for _, p := range op.Headers {
+			params = append(params, map[string]any{"name": p.Name, "in": "header", "description": p.Description, "schema": p.Schema})
+		}
+
+		success := map[string]any{"description": http.StatusText(op.Status)}
+		if len(op.Response) > 0 {
+			success["content"] = b.content(op.Response)
+		}
+		responses := map[string]any{
+			strconv.Itoa(op.Status): success,
+			"default":               map[string]any{"$ref": "#/components/responses/Problem"},
+		}
+		for status, description := range op.Other {
+			responses[strconv.Itoa(status)] = map[string]any{"description": description}
+		}
+
+		operation := map[string]any{
+			"operationId": op.operationID(),
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"responses":   responses,
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if len(op.Body) > 0 {
+			operation["requestBody"] = map[string]any{"required": true, "content": b.content(op.Body)}
+		}
+		if op.Access != accessPublic {
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+		description := op.Details
+		switch len(op.Needs) {
+		case 1:
+			description += fmt.Sprintf(" Requires the %s permission.", op.Needs[0])
+		case 2:
+			description += fmt.Sprintf(" Requires %s on your own resources, %s on anybody else's.", op.Needs[0], op.Needs[1])
+		}
+		if op.Publish {
+			description += fmt.Sprintf(" Publishing or scheduling a post also requires %s.", PermPublishPosts)
+		}
+		if description != "" {
+			operation["description"] = strings.TrimSpace(description)
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   h.Config.SiteTitle + " API",
+			"version": apiVersion,
+		},
+		"servers": []map[string]any{{"url": h.Config.BaseURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":   b.components,
+			"responses": map[string]any{"Problem": problem},
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+func (h *Handler) getOpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.openAPIDocument())
+}
+
+// apiDocsPage renders /openapi.json in the browser. It is self-contained, so
+// /docs works offline and runs no third-party code.
+//
+//go:embed apidocs.html
+var apiDocsPage string
+
+func (h *Handler) getAPIDocs(c echo.Context) error {
+	return c.HTML(http.StatusOK, apiDocsPage)
+}
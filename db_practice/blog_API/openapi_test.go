@@ -0,0 +1,405 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// routeHandler is the Handler method name behind a route, from Echo's
+// "main.(*Handler).getAllPosts-fm".
+func routeHandler(r *echo.Route) string {
+	name := strings.TrimSuffix(r.Name, "-fm")
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// TestAPIDocsMatchRoutes compares the routes of setupRoutes with
+// apiOperations, so a route can't be added, moved or removed without the
+// document following along.
+func TestAPIDocsMatchRoutes(t *testing.T) {
+	e := echo.New()
+	setupRoutes(e, &Handler{Config: &Config{}})
+
+	documented := make(map[string]*apiOperation, len(apiOperations))
+	for i := range apiOperations {
+		op := &apiOperations[i]
+		documented[op.Method+" "+op.Path] = op
+	}
+
+	var drift []string
+	registered := make(map[string]bool)
+	for _, r := range e.Routes() {
+		key := r.Method + " " + r.Path
+		registered[key] = true
+		op, ok := documented[key]
+		switch {
+		case !ok:
+			drift = append(drift, key+" is not documented")
+		case op.Handler != routeHandler(r):
+			drift = append(drift, key+" is served by "+routeHandler(r)+", documented as "+op.Handler)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			drift = append(drift, key+" is documented but not registered")
+		}
+	}
+
+	slices.Sort(drift)
+	for _, d := range drift {
+		t.Error(d)
+	}
+}
+
+// handlerSource is what the source of a handler, and of the package
+// functions it calls, says about the requests it takes and the responses it
+// writes.
+type handlerSource struct {
+	query  map[string]bool // names passed to QueryParam or QueryParams()[...]
+	binds  map[string]bool // types of the values passed to Bind
+	status map[int]bool    // statuses the response is written with
+}
+
+// responseWriters are the methods that take a status as their first
+// argument and write the response with it.
+var responseWriters = map[string]bool{
+	"JSON": true, "JSONBlob": true, "XML": true, "XMLBlob": true, "Blob": true, "Stream": true,
+	"String": true, "HTML": true, "HTMLBlob": true, "NoContent": true, "Redirect": true, "WriteHeader": true,
+}
+
+// statusCodes maps the names of the net/http status constants to their
+// values.
+func statusCodes() map[string]int {
+	codes := make(map[string]int)
+	for code := 100; code < 600; code++ {
+		if text := http.StatusText(code); text != "" {
+			codes["Status"+strings.NewReplacer(" ", "", "-", "").Replace(text)] = code
+		}
+	}
+	return codes
+}
+
+// packageFuncs parses the package, minus its tests, and indexes its
+// functions by name and its Handler methods by "Handler.name".
+func packageFuncs(t *testing.T) map[string]*ast.FuncDecl {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, file := range pkgs["main"].Files {
+		if strings.HasSuffix(fset.Position(file.Pos()).Filename, "_test.go") {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			funcs[funcKey(fn)] = fn
+		}
+	}
+	return funcs
+}
+
+func funcKey(fn *ast.FuncDecl) string {
+	if fn.Recv == nil {
+		return fn.Name.Name
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// inspectHandler collects the handlerSource of a Handler method, following
+// calls into package functions and other Handler methods.
+func inspectHandler(t *testing.T, funcs map[string]*ast.FuncDecl, codes map[string]int, name string) handlerSource {
+	src := handlerSource{query: map[string]bool{}, binds: map[string]bool{}, status: map[int]bool{}}
+	seen := make(map[string]bool)
+
+	var visit func(key string, literalArgs map[int]string)
+	visit = func(key string, literalArgs map[int]string) {
+		// A helper can read a different query parameter for each caller.
+		call := key + fmt.Sprint(literalArgs)
+		fn, ok := funcs[key]
+		if !ok || seen[call] {
+			return
+		}
+		seen[call] = true
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				if index, ok := n.(*ast.IndexExpr); ok && isMethodCall(index.X, "QueryParams") {
+					if s, ok := stringLit(index.Index); ok {
+						src.query[s] = true
+					}
+				}
+				return true
+			}
+
+			switch callee := call.Fun.(type) {
+			case *ast.Ident:
+				visit(callee.Name, callLiterals(call))
+			case *ast.SelectorExpr:
+				method := callee.Sel.Name
+				switch {
+				case isIdent(callee.X, "http") && method == "ServeContent":
+					// Range and conditional requests, besides errors.
+					for _, code := range []int{http.StatusOK, http.StatusPartialContent, http.StatusNotModified} {
+						src.status[code] = true
+					}
+				case method == "ServeHTTP":
+					// Handing the request to an http.Handler, which answers
+					// 200 unless it fails.
+					src.status[http.StatusOK] = true
+				case method == "QueryParam" && len(call.Args) == 1:
+					for _, s := range queryNames(t, fn, call.Args[0], literalArgs) {
+						src.query[s] = true
+					}
+				case method == "Bind" && len(call.Args) == 1:
+					src.binds[boundType(t, fn, call.Args[0])] = true
+				case responseWriters[method] && len(call.Args) > 0:
+					if sel, ok := call.Args[0].(*ast.SelectorExpr); ok && isIdent(sel.X, "http") {
+						code, ok := codes[sel.Sel.Name]
+						if !ok {
+							t.Fatalf("%s: unknown status http.%s", key, sel.Sel.Name)
+						}
+						src.status[code] = true
+					}
+				default:
+					if recv, ok := callee.X.(*ast.Ident); ok && isReceiver(fn, recv.Name) {
+						typ, _, _ := strings.Cut(key, ".")
+						visit(typ+"."+method, callLiterals(call))
+					}
+				}
+			}
+			return true
+		})
+	}
+	visit("Handler."+name, nil)
+	if funcs["Handler."+name] == nil {
+		t.Fatalf("no source for handler %s", name)
+	}
+	return src
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	ident, ok := e.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+func isMethodCall(e ast.Expr, method string) bool {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == method
+}
+
+func isReceiver(fn *ast.FuncDecl, name string) bool {
+	return fn.Recv != nil && len(fn.Recv.List[0].Names) > 0 && fn.Recv.List[0].Names[0].Name == name
+}
+
+func stringLit(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// callLiterals are the string literal arguments of a call by position.
+func callLiterals(call *ast.CallExpr) map[int]string {
+	lits := make(map[int]string)
+	for i, arg := range call.Args {
+		if s, ok := stringLit(arg); ok {
+			lits[i] = s
+		}
+	}
+	return lits
+}
+
+// queryNames resolves the argument of QueryParam: a string literal, a
+// parameter of fn the caller passed a literal for, or the key of a range
+// over a map literal.
+func queryNames(t *testing.T, fn *ast.FuncDecl, arg ast.Expr, literalArgs map[int]string) []string {
+	if s, ok := stringLit(arg); ok {
+		return []string{s}
+	}
+	ident, ok := arg.(*ast.Ident)
+	if !ok {
+		t.Fatalf("%s: QueryParam with a %T argument", fn.Name.Name, arg)
+	}
+
+	i := 0
+	for _, field := range fn.Type.Params.List {
+		for _, name := range field.Names {
+			if name.Name == ident.Name {
+				if s, ok := literalArgs[i]; ok {
+					return []string{s}
+				}
+				t.Fatalf("%s: QueryParam(%s) without a literal from the caller", fn.Name.Name, ident.Name)
+			}
+			i++
+		}
+	}
+
+	var names []string
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		r, ok := n.(*ast.RangeStmt)
+		if !ok || !isIdent(r.Key, ident.Name) {
+			return true
+		}
+		if lit, ok := r.X.(*ast.CompositeLit); ok {
+			for _, elt := range lit.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if s, ok := stringLit(kv.Key); ok {
+						names = append(names, s)
+					}
+				}
+			}
+		}
+		return false
+	})
+	if len(names) == 0 {
+		t.Fatalf("%s: can't tell which query parameter QueryParam(%s) reads", fn.Name.Name, ident.Name)
+	}
+	return names
+}
+
+// boundType is the name of the type of the value passed to Bind, from the
+// declaration of that value in fn.
+func boundType(t *testing.T, fn *ast.FuncDecl, arg ast.Expr) string {
+	if u, ok := arg.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		arg = u.X
+	}
+	ident, ok := arg.(*ast.Ident)
+	if !ok {
+		t.Fatalf("%s: Bind with a %T argument", fn.Name.Name, arg)
+	}
+
+	var typ ast.Expr
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch decl := n.(type) {
+		case *ast.ValueSpec:
+			for i, name := range decl.Names {
+				if name.Name != ident.Name {
+					continue
+				}
+				if decl.Type != nil {
+					typ = decl.Type
+				} else if i < len(decl.Values) {
+					typ = valueType(decl.Values[i])
+				}
+			}
+		case *ast.AssignStmt:
+			if decl.Tok != token.DEFINE {
+				return true
+			}
+			for i, lhs := range decl.Lhs {
+				if isIdent(lhs, ident.Name) && i < len(decl.Rhs) {
+					typ = valueType(decl.Rhs[i])
+				}
+			}
+		}
+		return typ == nil
+	})
+	name, ok := typ.(*ast.Ident)
+	if !ok {
+		t.Fatalf("%s: can't tell the type of %s passed to Bind", fn.Name.Name, ident.Name)
+	}
+	return name.Name
+}
+
+// valueType is the type of new(T), T{...} or &T{...}.
+func valueType(e ast.Expr) ast.Expr {
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		e = u.X
+	}
+	switch v := e.(type) {
+	case *ast.CompositeLit:
+		return v.Type
+	case *ast.CallExpr:
+		if isIdent(v.Fun, "new") && len(v.Args) == 1 {
+			return v.Args[0]
+		}
+	}
+	return nil
+}
+
+// TestAPIDocsMatchHandlers checks each operation against the source of its
+// handler: the query parameters it reads, the type it binds the body to and
+// the statuses it answers with besides errors.
+func TestAPIDocsMatchHandlers(t *testing.T) {
+	funcs := packageFuncs(t)
+	codes := statusCodes()
+
+	for i := range apiOperations {
+		op := &apiOperations[i]
+		name := op.Method + " " + op.Path
+		src := inspectHandler(t, funcs, codes, op.Handler)
+
+		query := make(map[string]bool)
+		for _, p := range op.Query {
+			query[p.Name] = true
+		}
+		if !maps.Equal(query, src.query) {
+			t.Errorf("%s documents query parameters %v, %s reads %v", name, slices.Sorted(maps.Keys(query)), op.Handler, slices.Sorted(maps.Keys(src.query)))
+		}
+
+		body := make(map[string]bool)
+		for _, ct := range op.Body {
+			if _, schema := ct.Value.(map[string]any); ct.Type == echo.MIMEApplicationJSON && !schema {
+				body[reflect.TypeOf(ct.Value).Name()] = true
+			}
+		}
+		if !maps.Equal(body, src.binds) {
+			t.Errorf("%s documents a JSON body of %v, %s binds %v", name, slices.Sorted(maps.Keys(body)), op.Handler, slices.Sorted(maps.Keys(src.binds)))
+		}
+
+		status := map[int]bool{op.Status: true}
+		for code := range op.Other {
+			status[code] = true
+		}
+		if !maps.Equal(status, src.status) {
+			t.Errorf("%s documents statuses %v, %s answers with %v", name, slices.Sorted(maps.Keys(status)), op.Handler, slices.Sorted(maps.Keys(src.status)))
+		}
+	}
+}
+
+func TestAPIDocsPage(t *testing.T) {
+	s := newTestServer(t)
+	rec := s.do(http.MethodGet, "/docs", "", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMETextHTML) {
+		t.Fatalf("GET /docs = %d %s", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	page := rec.Body.String()
+	if !strings.Contains(page, `"/openapi.json"`) {
+		t.Error("/docs doesn't load /openapi.json")
+	}
+	for _, ref := range []string{`src="`, `href="http`, `href="//`, "@import", "url("} {
+		if strings.Contains(page, ref) {
+			t.Errorf("/docs loads something from elsewhere (%s)", ref)
+		}
+	}
+}
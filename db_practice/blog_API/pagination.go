@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var postSortColumns = map[string]string{
+	"created_at": "posts.created_at",
+	"updated_at": "posts.updated_at",
+	"title":      "posts.title",
+}
+
+type pageInfo struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+type page[T any] struct {
+	Data       []T      `json:"data"`
+	Pagination pageInfo `json:"pagination"`
+}
+
+type postCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Prev  bool   `json:"p,omitempty"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func (cur postCursor) encode() string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePostCursor(s string) (*postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+	cur := new(postCursor)
+	if err := json.Unmarshal(raw, cur); err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+	if _, ok := postSortColumns[cur.Sort]; !ok || cur.ID == 0 {
+		return nil, errors.New("Invalid cursor")
+	}
+	return cur, nil
+}
+
+type postListParams struct {
+	Limit         int
+	Sort          string
+	Desc          bool
+	Cursor        *postCursor
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	TitleContains string
+	Tags          []string
+	MatchAllTags  bool
+	Status        string
+	IncludeDrafts bool
+	Viewer        *authUser
+}
+
+func parsePostListParams(c echo.Context) (*postListParams, error) {
+	p := &postListParams{Limit: defaultPageLimit, Sort: "created_at", Desc: true}
+
+	if s := c.QueryParam("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, errors.New("Invalid limit, must be between 1 and " + strconv.Itoa(maxPageLimit))
+		}
+		p.Limit = limit
+	}
+
+	if s := c.QueryParam("sort"); s != "" {
+		if _, ok := postSortColumns[s]; !ok {
+			return nil, errors.New("Invalid sort, must be one of created_at, updated_at, title")
+		}
+		p.Sort = s
+	}
+
+	switch c.QueryParam("order") {
+	case "":
+	case "asc":
+		p.Desc = false
+	case "desc":
+		p.Desc = true
+	default:
+		return nil, errors.New("Invalid order, must be asc or desc")
+	}
+
+	if s := c.QueryParam("cursor"); s != "" {
+		cur, err := decodePostCursor(s)
+		if err != nil {
+			return nil, err
+		}
+		if (c.QueryParam("sort") != "" && cur.Sort != p.Sort) || (c.QueryParam("order") != "" && cur.Desc != p.Desc) {
+			return nil, errors.New("Cursor does not match sort order")
+		}
+		if cur.Sort != "title" {
+			if _, err := time.Parse(time.RFC3339Nano, cur.Value); err != nil {
+				return nil, errors.New("Invalid cursor")
+			}
+		}
+		p.Sort, p.Desc, p.Cursor = cur.Sort, cur.Desc, cur
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &p.CreatedAfter,
+		"created_before": &p.CreatedBefore,
+	} {
+		s := c.QueryParam(name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors.New("Invalid " + name + ", must be an RFC 3339 timestamp")
+		}
+		t = t.Local()
+		*dst = &t
+	}
+
+	p.TitleContains = c.QueryParam("title_contains")
+
+	for _, tag := range c.QueryParams()["tag"] {
+		if name := normalizeTagName(tag); name != "" {
+			p.Tags = append(p.Tags, name)
+		}
+	}
+	switch c.QueryParam("tag_mode") {
+	case "", "any":
+	case "all":
+		p.MatchAllTags = true
+	default:
+		return nil, errors.New("Invalid tag_mode, must be any or all")
+	}
+
+	p.Viewer = currentUser(c)
+	switch c.QueryParam("include") {
+	case "":
+	case "drafts":
+		if p.Viewer == nil {
+			return nil, errLoginRequired
+		}
+		p.IncludeDrafts = true
+	default:
+		return nil, errors.New("Invalid include, must be drafts")
+	}
+	if s := c.QueryParam("status"); s != "" {
+		if !isPostStatus(s) {
+			return nil, errors.New("Invalid status, must be one of draft, scheduled, published, archived")
+		}
+		p.Status = s
+	}
+
+	return p, nil
+}
+
+func (p *postListParams) applyFilters(q *gorm.DB) *gorm.DB {
+	q = visiblePosts(q, p.Viewer, p.IncludeDrafts)
+	if p.Status != "" {
+		q = q.Where("posts.status = ?", p.Status)
+	}
+	if p.CreatedAfter != nil {
+		q = q.Where("posts.created_at > ?", *p.CreatedAfter)
+	}
+	if p.CreatedBefore != nil {
+		q = q.Where("posts.created_at < ?", *p.CreatedBefore)
+	}
+	if p.TitleContains != "" {
+		q = q.Where("posts.title LIKE ? ESCAPE '\\'", "%"+escapeLike(p.TitleContains)+"%")
+	}
+	if len(p.Tags) > 0 {
+		q = tagFilter(q, p.Tags, p.MatchAllTags)
+	}
+	return q
+}
+
+func (cur *postCursor) value() any {
+	if cur.Sort == "title" {
+		return cur.Value
+	}
+	t, _ := time.Parse(time.RFC3339Nano, cur.Value)
+	return t
+}
+
+func (p *postListParams) cursorFor(post Post, prev bool) string {
+	cur := postCursor{Sort: p.Sort, Desc: p.Desc, Prev: prev, ID: post.ID}
+	switch p.Sort {
+	case "title":
+		cur.Value = post.Title
+	case "updated_at":
+		cur.Value = post.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		cur.Value = post.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return cur.encode()
+}
+
+// paginate runs q as a keyset query and fills in the cursors of the returned page.
+func (p *postListParams) paginate(q *gorm.DB) (*page[Post], error) {
+	col := postSortColumns[p.Sort]
+	backward := p.Cursor != nil && p.Cursor.Prev
+
+	desc := p.Desc != backward
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if p.Cursor != nil {
+		v := p.Cursor.value()
+		q = q.Where("("+col+" "+cmp+" ?) OR ("+col+" = ? AND posts.id "+cmp+" ?)", v, v, p.Cursor.ID)
+	}
+
+	posts := make([]Post, 0, p.Limit+1)
+	if err := q.Order(col + " " + dir).Order("posts.id " + dir).Limit(p.Limit + 1).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+
+	hasMore := len(posts) > p.Limit
+	if hasMore {
+		posts = posts[:p.Limit]
+	}
+	if backward {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+
+	result := &page[Post]{Data: posts, Pagination: pageInfo{Limit: p.Limit}}
+	if len(posts) == 0 {
+		return result, nil
+	}
+	if (!backward && hasMore) || (backward && p.Cursor != nil) {
+		result.Pagination.NextCursor = p.cursorFor(posts[len(posts)-1], false)
+	}
+	if (backward && hasMore) || (!backward && p.Cursor != nil) {
+		result.Pagination.PrevCursor = p.cursorFor(posts[0], true)
+	}
+	return result, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
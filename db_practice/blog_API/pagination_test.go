@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// seedPosts stores posts with fixed timestamps. Several share a title, a
+// creation or an update time, so that the ID has to break ties.
+func seedPosts(t *testing.T, db *gorm.DB) []Post {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	posts := []Post{
+		{Model: gorm.Model{CreatedAt: at(0), UpdatedAt: at(5)}, Title: "Beta", Slug: "p1", Content: "1"},
+		{Model: gorm.Model{CreatedAt: at(1), UpdatedAt: at(5)}, Title: "alpha", Slug: "p2", Content: "2"},
+		{Model: gorm.Model{CreatedAt: at(1), UpdatedAt: at(3)}, Title: "Beta", Slug: "p3", Content: "3"},
+		{Model: gorm.Model{CreatedAt: at(1), UpdatedAt: at(1)}, Title: "Gamma", Slug: "p4", Content: "4"},
+		{Model: gorm.Model{CreatedAt: at(2), UpdatedAt: at(3)}, Title: "Delta", Slug: "p5", Content: "5"},
+		{Model: gorm.Model{CreatedAt: at(3), UpdatedAt: at(0)}, Title: "Beta", Slug: "p6", Content: "6"},
+		{Model: gorm.Model{CreatedAt: at(4), UpdatedAt: at(5)}, Title: "Epsilon", Slug: "p7", Content: "7"},
+	}
+	if err := db.Create(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	return posts
+}
+
+// expectedOrder is the IDs of posts sorted by key, with the ID as tie-breaker.
+func expectedOrder(posts []Post, sort string, desc bool) []uint {
+	sorted := slices.Clone(posts)
+	slices.SortFunc(sorted, func(a, b Post) int {
+		var c int
+		switch sort {
+		case "title":
+			c = strings.Compare(a.Title, b.Title)
+		case "updated_at":
+			c = a.UpdatedAt.Compare(b.UpdatedAt)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = int(a.ID) - int(b.ID)
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	})
+	ids := make([]uint, len(sorted))
+	for i, p := range sorted {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+func getPage(t *testing.T, s *testServer, query url.Values) page[Post] {
+	t.Helper()
+	rec := s.do(http.MethodGet, "/posts?"+query.Encode(), "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /posts?%s = %d %s", query.Encode(), rec.Code, rec.Body)
+	}
+	return decodeJSON[page[Post]](t, rec)
+}
+
+func pageIDs(p page[Post]) []uint {
+	ids := make([]uint, len(p.Data))
+	for i, post := range p.Data {
+		ids[i] = post.ID
+	}
+	return ids
+}
+
+func TestPostCursorsWalkBothWays(t *testing.T) {
+	s := newTestServer(t)
+	posts := seedPosts(t, s.DB)
+
+	for _, sort := range []string{"created_at", "updated_at", "title"} {
+		for _, order := range []string{"asc", "desc"} {
+			t.Run(sort+" "+order, func(t *testing.T) {
+				want := expectedOrder(posts, sort, order == "desc")
+
+				var forward [][]uint
+				var last page[Post]
+				query := url.Values{"sort": {sort}, "order": {order}, "limit": {"2"}}
+				for {
+					p := getPage(t, s, query)
+					if len(forward) == 0 && p.Pagination.PrevCursor != "" {
+						t.Error("first page has a prev_cursor")
+					}
+					forward = append(forward, pageIDs(p))
+					last = p
+					if p.Pagination.NextCursor == "" {
+						break
+					}
+					if len(forward) > len(posts) {
+						t.Fatal("next_cursor never runs out")
+					}
+					query = url.Values{"cursor": {p.Pagination.NextCursor}, "limit": {"2"}}
+				}
+				if got := slices.Concat(forward...); !slices.Equal(got, want) {
+					t.Fatalf("walking forward = %v, want %v", got, want)
+				}
+
+				// Going back from the last page visits the same pages in reverse.
+				cursor := last.Pagination.PrevCursor
+				for i := len(forward) - 2; i >= 0; i-- {
+					if cursor == "" {
+						t.Fatalf("page %d has no prev_cursor", i+1)
+					}
+					p := getPage(t, s, url.Values{"cursor": {cursor}, "limit": {"2"}})
+					if got := pageIDs(p); !slices.Equal(got, forward[i]) {
+						t.Errorf("page %d walking back = %v, want %v", i, got, forward[i])
+					}
+					if p.Pagination.NextCursor == "" {
+						t.Errorf("page %d walking back has no next_cursor", i)
+					}
+					cursor = p.Pagination.PrevCursor
+				}
+				if cursor != "" {
+					t.Error("first page reached walking back still has a prev_cursor")
+				}
+			})
+		}
+	}
+}
+
+func TestPostListFilters(t *testing.T) {
+	s := newTestServer(t)
+	posts := seedPosts(t, s.DB)
+	if err := s.DB.Create(&Post{Title: "100% Beta_", Slug: "p8", Content: "8"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	p := getPage(t, s, url.Values{"title_contains": {"%"}})
+	if len(p.Data) != 1 || p.Data[0].Title != "100% Beta_" {
+		t.Errorf("title_contains=%% = %v, want only the post with a literal %%", pageIDs(p))
+	}
+	p = getPage(t, s, url.Values{"title_contains": {"eta"}, "sort": {"created_at"}, "order": {"asc"}})
+	if want := []uint{posts[0].ID, posts[2].ID, posts[5].ID, posts[6].ID + 1}; !slices.Equal(pageIDs(p), want) {
+		t.Errorf("title_contains=eta = %v, want %v", pageIDs(p), want)
+	}
+
+	after := posts[4].CreatedAt.Format(time.RFC3339)
+	before := posts[6].CreatedAt.Format(time.RFC3339)
+	p = getPage(t, s, url.Values{"created_after": {after}, "created_before": {before}})
+	if want := []uint{posts[5].ID}; !slices.Equal(pageIDs(p), want) {
+		t.Errorf("created_after=%s&created_before=%s = %v, want %v", after, before, pageIDs(p), want)
+	}
+}
+
+func TestInvalidPostListParams(t *testing.T) {
+	s := newTestServer(t)
+	seedPosts(t, s.DB)
+
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	valid := postCursor{Sort: "title", Value: "Beta", ID: 1}.encode()
+
+	for name, query := range map[string]url.Values{
+		"cursor not base64":        {"cursor": {"!!!"}},
+		"cursor not JSON":          {"cursor": {encode("not json")}},
+		"cursor with unknown key":  {"cursor": {encode(`{"s":"content","v":"x","id":1}`)}},
+		"cursor without ID":        {"cursor": {encode(`{"s":"title","v":"Beta"}`)}},
+		"cursor with bad time":     {"cursor": {encode(`{"s":"created_at","v":"yesterday","id":1}`)}},
+		"cursor for another sort":  {"cursor": {valid}, "sort": {"created_at"}},
+		"cursor for another order": {"cursor": {valid}, "order": {"desc"}},
+		"limit zero":               {"limit": {"0"}},
+		"limit too large":          {"limit": {"101"}},
+		"unknown sort":             {"sort": {"content"}},
+		"unknown order":            {"order": {"up"}},
+		"bad created_after":        {"created_after": {"2026-01-01"}},
+	} {
+		if rec := s.do(http.MethodGet, "/posts?"+query.Encode(), "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: GET /posts?%s = %d, want 400", name, query.Encode(), rec.Code)
+		}
+	}
+}
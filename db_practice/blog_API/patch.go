@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+
+	maxPatchSize = 1 << 20
+)
+
+// postDocument is the part of a post that PATCH requests can change.
+type postDocument struct {
+	Title     string     `json:"title"`
+	Slug      string     `json:"slug"`
+	Content   string     `json:"content"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+	Tags      []string   `json:"tags"`
+}
+
+func newPostDocument(post *Post) postDocument {
+	doc := postDocument{
+		Title:     post.Title,
+		Slug:      post.Slug,
+		Content:   post.Content,
+		Status:    post.Status,
+		PublishAt: post.PublishAt,
+		Tags:      make([]string, 0, len(post.Tags)),
+	}
+	for _, tag := range post.Tags {
+		doc.Tags = append(doc.Tags, tag.Name)
+	}
+	return doc
+}
+
+// applyPostPatch applies a merge patch or JSON patch to the editable fields
+// of post and returns the patched document.
+func applyPostPatch(post *Post, contentType string, patch []byte) (*postDocument, error) {
+	original, err := json.Marshal(newPostDocument(post))
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+	switch contentType {
+	case mimeMergePatch:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case mimeJSONPatch:
+		var ops jsonpatch.Patch
+		if ops, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = ops.Apply(original)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc := new(postDocument)
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (h *Handler) patchPost(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
+	}
+
+	contentType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if contentType != mimeMergePatch && contentType != mimeJSONPatch {
+		c.Response().Header().Set("Accept-Patch", mimeMergePatch+", "+mimeJSONPatch)
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be "+mimeMergePatch+" or "+mimeJSONPatch)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPatchSize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+	if len(body) > maxPatchSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Patch is too large")
+	}
+
+	var post Post
+	if err := h.DB.Preload("Tags").First(&post, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+		}
+		c.Logger().Errorf("Database error finding post %d for patch: %v", id, err)
+		return dbError(err, "Failed to find post for update")
+	}
+
+	if err := authorizeOwned(currentUser(c), post.AuthorID, PermEditOwnPosts, PermEditAnyPost); err != nil {
+		return err
+	}
+	if err := h.checkIfMatch(c, &post); err != nil {
+		return err
+	}
+
+	doc, err := applyPostPatch(&post, contentType, body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "Failed to apply patch: "+err.Error())
+	}
+
+	before := post
+	post.Title, post.Slug, post.Content, post.Status, post.PublishAt = doc.Title, doc.Slug, doc.Content, doc.Status, doc.PublishAt
+	if err := validatePost(&post); err != nil {
+		return err
+	}
+	if err := authorizeStatus(currentUser(c), &before, &post); err != nil {
+		return err
+	}
+
+	tags := make([]Tag, len(doc.Tags))
+	for i, name := range doc.Tags {
+		tags[i].Name = name
+	}
+	tagNames, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return saveUpdatedPost(tx, &before, &post, tagNames, currentUser(c).ID)
+	})
+	if errors.Is(err, errPostGone) {
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	}
+	if errors.Is(err, errStaleVersion) {
+		return staleVersion(c)
+	}
+	if err != nil {
+		c.Logger().Errorf("Database error patching post %d: %v", id, err)
+		return dbError(err, "Failed to update post")
+	}
+
+	c.Response().Header().Set("ETag", postETag(&post))
+	return c.JSON(http.StatusOK, post)
+}
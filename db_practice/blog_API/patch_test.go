@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestPatchPost(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleAuthor)
+	post := s.createPost(t, author, map[string]any{"title": "Original", "content": "Body", "tags": []string{"go"}})
+	path := fmt.Sprintf("/posts/%d", post.ID)
+
+	patch := func(contentType, body string) (int, Post) {
+		t.Helper()
+		rec := s.do(http.MethodPatch, path, author, body, echo.HeaderContentType, contentType)
+		var current Post
+		if err := s.DB.Preload("Tags").First(&current, post.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, current
+	}
+
+	code, current := patch(mimeMergePatch, `{"title": "Merged"}`)
+	if code != http.StatusOK || current.Title != "Merged" || current.Content != "Body" || len(current.Tags) != 1 {
+		t.Errorf("merge patch = %d %+v, want only the title changed", code, current)
+	}
+
+	code, current = patch(mimeJSONPatch, `[{"op": "add", "path": "/tags/-", "value": "sqlite"}, {"op": "test", "path": "/title", "value": "Merged"}]`)
+	if code != http.StatusOK || len(current.Tags) != 2 {
+		t.Errorf("JSON patch = %d, tags %+v, want go and sqlite", code, current.Tags)
+	}
+
+	for name, tc := range map[string]struct {
+		contentType, body string
+		code              int
+	}{
+		"failing test op": {mimeJSONPatch, `[{"op": "replace", "path": "/title", "value": "Half done"}, {"op": "test", "path": "/content", "value": "Wrong"}]`, http.StatusUnprocessableEntity},
+		"remove title":    {mimeJSONPatch, `[{"op": "remove", "path": "/title"}]`, http.StatusBadRequest},
+		"null content":    {mimeMergePatch, `{"content": null}`, http.StatusBadRequest},
+		"set id":          {mimeJSONPatch, `[{"op": "replace", "path": "/id", "value": 99}]`, http.StatusUnprocessableEntity},
+		"add author_id":   {mimeJSONPatch, `[{"op": "add", "path": "/author_id", "value": 99}]`, http.StatusUnprocessableEntity},
+		"merge author_id": {mimeMergePatch, `{"title": "Stolen", "author_id": 99}`, http.StatusUnprocessableEntity},
+		"invalid JSON":    {mimeMergePatch, `{"title":`, http.StatusUnprocessableEntity},
+		"bad status":      {mimeMergePatch, `{"status": "gone"}`, http.StatusBadRequest},
+	} {
+		code, current := patch(tc.contentType, tc.body)
+		if code != tc.code {
+			t.Errorf("%s: PATCH = %d, want %d", name, code, tc.code)
+		}
+		// Nothing of a rejected patch may stick, not even its first ops.
+		if current.Title != "Merged" || current.Content != "Body" || current.AuthorID != post.AuthorID || len(current.Tags) != 2 {
+			t.Errorf("%s: post changed to %+v", name, current)
+		}
+	}
+
+	rec := s.do(http.MethodPatch, path, author, `{"title": "Plain JSON"}`)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH with application/json = %d, want 415", rec.Code)
+	}
+	if got := rec.Header().Get("Accept-Patch"); got != mimeMergePatch+", "+mimeJSONPatch {
+		t.Errorf("Accept-Patch = %q", got)
+	}
+}
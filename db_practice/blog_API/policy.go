@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleAuthor = "author"
+	RoleReader = "reader"
+)
+
+const codePermissionDenied = "permission_denied"
+
+// Permission is something a role allows. Handlers never look at roles
+// directly; they ask the policy for a permission.
+type Permission string
+
+const (
+	PermCreatePosts      Permission = "posts:create"
+	PermEditOwnPosts     Permission = "posts:edit_own"
+	PermEditAnyPost      Permission = "posts:edit_any"
+	PermDeleteOwnPosts   Permission = "posts:delete_own"
+	PermDeleteAnyPost    Permission = "posts:delete_any"
+	PermPublishPosts     Permission = "posts:publish"
+	PermReadDrafts       Permission = "posts:read_drafts"
+	PermComment          Permission = "comments:create"
+	PermModerateComments Permission = "comments:moderate"
+	PermManageUsers      Permission = "users:manage"
+	PermManageSite       Permission = "site:manage"
+)
+
+var authorPermissions = []Permission{PermCreatePosts, PermEditOwnPosts, PermDeleteOwnPosts, PermComment}
+
+var editorPermissions = append(slices.Clone(authorPermissions), PermEditAnyPost, PermDeleteAnyPost, PermPublishPosts, PermReadDrafts, PermModerateComments)
+
+// rolePermissions is the permission matrix. Readers, like anonymous
+// visitors, may only read published posts and their comments.
+var rolePermissions = map[string][]Permission{
+	RoleReader: {},
+	RoleAuthor: authorPermissions,
+	RoleEditor: editorPermissions,
+	RoleAdmin:  append(slices.Clone(editorPermissions), PermManageUsers, PermManageSite),
+}
+
+var roles = []string{RoleReader, RoleAuthor, RoleEditor, RoleAdmin}
+
+func isRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// can reports whether user holds perm. Anonymous callers hold nothing.
+func can(user *authUser, perm Permission) bool {
+	return user != nil && slices.Contains(rolePermissions[user.Role], perm)
+}
+
+// forbidden is the 403 for a caller who lacks perm. The permission is part
+// of the problem document, so clients can tell what to ask an admin for.
+func forbidden(perm Permission) *Problem {
+	p := newProblem(http.StatusForbidden, codePermissionDenied, "Missing permission "+string(perm))
+	p.Permission = string(perm)
+	return p
+}
+
+func authorize(user *authUser, perm Permission) error {
+	if !can(user, perm) {
+		return forbidden(perm)
+	}
+	return nil
+}
+
+// authorizeOwned checks an action on something owned by ownerID: its owner
+// needs own, everyone else needs any.
+func authorizeOwned(user *authUser, ownerID uint, own, any Permission) error {
+	if user != nil && ownerID != 0 && user.ID == ownerID && can(user, own) {
+		return nil
+	}
+	if can(user, any) {
+		return nil
+	}
+	if user != nil && ownerID != 0 && user.ID == ownerID {
+		return forbidden(own)
+	}
+	return forbidden(any)
+}
+
+// authorizeStatus checks the status post is saved with. Making a post
+// public, now or on a schedule, needs PermPublishPosts; authors hand their
+// drafts to an editor. before is nil for a new post.
+func authorizeStatus(user *authUser, before, post *Post) error {
+	if post.Status != StatusPublished && post.Status != StatusScheduled {
+		return nil
+	}
+	if before != nil && before.Status == post.Status {
+		return nil
+	}
+	return authorize(user, PermPublishPosts)
+}
+
+// requirePermission guards a route with perm. It goes after requireAuth, so
+// anonymous callers get a 401 rather than a 403.
+func requirePermission(perm Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := authorize(currentUser(c), perm); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
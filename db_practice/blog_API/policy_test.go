@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// allPermissions lists every permission, so that a new one can't be added
+// without deciding here who holds it.
+var allPermissions = []Permission{
+	PermCreatePosts, PermEditOwnPosts, PermEditAnyPost, PermDeleteOwnPosts, PermDeleteAnyPost,
+	PermPublishPosts, PermReadDrafts, PermComment, PermModerateComments, PermManageUsers, PermManageSite,
+}
+
+func TestRolePermissions(t *testing.T) {
+	// The lowest role holding each permission; every role above holds it too.
+	lowest := map[Permission]string{
+		PermCreatePosts:      RoleAuthor,
+		PermEditOwnPosts:     RoleAuthor,
+		PermDeleteOwnPosts:   RoleAuthor,
+		PermComment:          RoleAuthor,
+		PermEditAnyPost:      RoleEditor,
+		PermDeleteAnyPost:    RoleEditor,
+		PermPublishPosts:     RoleEditor,
+		PermReadDrafts:       RoleEditor,
+		PermModerateComments: RoleEditor,
+		PermManageUsers:      RoleAdmin,
+		PermManageSite:       RoleAdmin,
+	}
+	if len(lowest) != len(allPermissions) {
+		t.Fatalf("expectations cover %d permissions, want all %d", len(lowest), len(allPermissions))
+	}
+
+	for rank, role := range roles {
+		user := &authUser{ID: 1, Username: role, Role: role}
+		for _, perm := range allPermissions {
+			want := rank >= slices.Index(roles, lowest[perm])
+			if got := can(user, perm); got != want {
+				t.Errorf("can(%s, %s) = %v, want %v", role, perm, got, want)
+			}
+		}
+	}
+	for role, perms := range rolePermissions {
+		for _, perm := range perms {
+			if !slices.Contains(allPermissions, perm) {
+				t.Errorf("role %s holds %s, which allPermissions doesn't list", role, perm)
+			}
+		}
+	}
+	for _, perm := range allPermissions {
+		if can(nil, perm) {
+			t.Errorf("an anonymous caller holds %s", perm)
+		}
+	}
+}
+
+func TestAuthorizeOwned(t *testing.T) {
+	author := &authUser{ID: 1, Role: RoleAuthor}
+	editor := &authUser{ID: 2, Role: RoleEditor}
+	tests := []struct {
+		user    *authUser
+		ownerID uint
+		missing Permission // empty when allowed
+	}{
+		{author, 1, ""},
+		{author, 3, PermEditAnyPost},
+		{author, 0, PermEditAnyPost},
+		{editor, 3, ""},
+		{&authUser{ID: 4, Role: RoleReader}, 4, PermEditOwnPosts},
+		{nil, 1, PermEditAnyPost},
+	}
+	for _, tt := range tests {
+		err := authorizeOwned(tt.user, tt.ownerID, PermEditOwnPosts, PermEditAnyPost)
+		if tt.missing == "" {
+			if err != nil {
+				t.Errorf("authorizeOwned(%+v, owner %d) = %v, want allowed", tt.user, tt.ownerID, err)
+			}
+			continue
+		}
+		if p, ok := err.(*Problem); !ok || p.Permission != string(tt.missing) {
+			t.Errorf("authorizeOwned(%+v, owner %d) = %v, want missing %s", tt.user, tt.ownerID, err, tt.missing)
+		}
+	}
+}
+
+func TestPermissionDeniedProblem(t *testing.T) {
+	s := newTestServer(t)
+	reader := s.login(t, "rita", RoleReader)
+
+	rec := s.do(http.MethodPost, "/posts", reader, map[string]any{"title": "Hi", "content": "There"})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("POST /posts as a reader = %d %s, want 403", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, mimeProblem) {
+		t.Errorf("Content-Type = %q, want %s", ct, mimeProblem)
+	}
+	p := decodeJSON[Problem](t, rec)
+	if p.Status != http.StatusForbidden || p.Code != codePermissionDenied || p.Permission != string(PermCreatePosts) {
+		t.Errorf("problem = %+v, want permission_denied missing %s", p, PermCreatePosts)
+	}
+	if p.Detail != "Missing permission "+string(PermCreatePosts) {
+		t.Errorf("detail = %q", p.Detail)
+	}
+}
+
+func TestPublishingNeedsPermission(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "ann", RoleAuthor)
+	editor := s.login(t, "ed", RoleEditor)
+
+	expectMissingPublish := func(what string, code int, body []byte) {
+		t.Helper()
+		if code != http.StatusForbidden {
+			t.Fatalf("%s = %d %s, want 403", what, code, body)
+		}
+		if !strings.Contains(string(body), `"missing_permission":"`+string(PermPublishPosts)+`"`) {
+			t.Errorf("%s body = %s, want missing %s", what, body, PermPublishPosts)
+		}
+	}
+
+	for _, status := range []map[string]any{
+		{"status": StatusPublished},
+		{"status": StatusScheduled, "publish_at": "2099-01-01T00:00:00Z"},
+	} {
+		body := map[string]any{"title": "Mine", "content": "Text"}
+		for k, v := range status {
+			body[k] = v
+		}
+		rec := s.do(http.MethodPost, "/posts", author, body)
+		expectMissingPublish("POST /posts "+status["status"].(string)+" as an author", rec.Code, rec.Body.Bytes())
+	}
+
+	draft := s.createPost(t, author, map[string]any{"title": "Draft", "content": "Text"})
+	path := "/posts/" + strconv.FormatUint(uint64(draft.ID), 10)
+
+	rec := s.do(http.MethodPut, path, author, map[string]any{"title": "Draft", "content": "Edited", "status": StatusPublished})
+	expectMissingPublish("PUT as an author", rec.Code, rec.Body.Bytes())
+	rec = s.do(http.MethodPatch, path, author, `{"status":"published"}`, "Content-Type", mimeMergePatch)
+	expectMissingPublish("PATCH as an author", rec.Code, rec.Body.Bytes())
+
+	// Authors keep editing their drafts; an editor publishes them.
+	if rec := s.do(http.MethodPut, path, author, map[string]any{"title": "Draft", "content": "Edited"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT draft as its author = %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodPatch, path, editor, `{"status":"published"}`, "Content-Type", mimeMergePatch); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH to published as an editor = %d %s", rec.Code, rec.Body)
+	}
+	// Editing a post that is already published doesn't publish it again.
+	if rec := s.do(http.MethodPatch, path, author, `{"content":"Fixed a typo"}`, "Content-Type", mimeMergePatch); rec.Code != http.StatusOK {
+		t.Errorf("PATCH published post as its author = %d %s", rec.Code, rec.Body)
+	}
+}
+
+// The role is looked up on every request, so a change applies to tokens
+// that were issued before it.
+func TestRoleChangesApplyImmediately(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login(t, "root", RoleAdmin)
+	author := s.login(t, "ann", RoleAuthor)
+	post := map[string]any{"title": "Mine", "content": "Text"}
+
+	s.createPost(t, author, post)
+	var ann User
+	if err := s.DB.Where("username = ?", "ann").First(&ann).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := "/admin/users/" + strconv.FormatUint(uint64(ann.ID), 10) + "/role"
+	if rec := s.do(http.MethodPut, path, admin, roleInput{Role: RoleReader}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT %s = %d %s", path, rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodPost, "/posts", author, post); rec.Code != http.StatusForbidden {
+		t.Errorf("POST /posts after the demotion = %d, want 403", rec.Code)
+	}
+
+	if err := s.DB.Delete(&ann).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rec := s.do(http.MethodGet, "/posts?include=drafts", author, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("request by a deleted user = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+const mimeProblem = "application/problem+json"
+
+// Stable error codes for failures that aren't described by the status alone.
+const (
+	codeValidationFailed    = "validation_failed"
+	codeRecordNotFound      = "record_not_found"
+	codeUniqueViolation     = "unique_violation"
+	codeForeignKeyViolation = "foreign_key_violation"
+	codeConstraintViolation = "constraint_violation"
+	codeDatabaseBusy        = "database_busy"
+	codeDatabaseError       = "database_error"
+)
+
+// Problem is an RFC 7807 problem details document. Handlers return one, an
+// *echo.HTTPError or a validation error, and handleError writes it out.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Code     string `json:"code"`
+	Instance string `json:"instance,omitempty"`
+	// Permission is set on 403s and names the permission the caller lacks.
+	Permission string       `json:"missing_permission,omitempty"`
+	Errors     []FieldError `json:"errors"`
+
+	err error
+}
+
+func (p *Problem) Error() string {
+	if p.err != nil {
+		return p.Detail + ": " + p.err.Error()
+	}
+	return p.Detail
+}
+
+func (p *Problem) Unwrap() error { return p.err }
+
+// FieldError describes one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string { return e.Field + " " + e.Message }
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// newProblem builds a problem for status. Without a code the status says it
+// all, so the type is about:blank as RFC 7807 suggests.
+func newProblem(status int, code, detail string) *Problem {
+	p := &Problem{Title: http.StatusText(status), Status: status, Detail: detail, Code: code, Errors: []FieldError{}}
+	if code == "" {
+		p.Type = "about:blank"
+		p.Code = strings.ToLower(strings.ReplaceAll(p.Title, " ", "_"))
+	}
+	if p.Detail == "" {
+		p.Detail = p.Title
+	}
+	return p
+}
+
+func validationFailed(errs ...FieldError) *Problem {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	p := newProblem(http.StatusBadRequest, codeValidationFailed, strings.Join(messages, "; "))
+	p.Errors = errs
+	return p
+}
+
+// dbError maps a database error to a problem with a stable code. Unexpected
+// failures keep detail, which should not leak anything about the query.
+func dbError(err error, detail string) *Problem {
+	status, code := http.StatusInternalServerError, codeDatabaseError
+
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status, code, detail = http.StatusNotFound, codeRecordNotFound, "Record not found"
+	case errors.As(err, &sqliteErr):
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			status, code, detail = http.StatusConflict, codeUniqueViolation, "A record with the same unique value already exists"
+		case sqlite3.ErrConstraintForeignKey:
+			status, code, detail = http.StatusConflict, codeForeignKeyViolation, "A referenced record does not exist"
+		default:
+			switch sqliteErr.Code {
+			case sqlite3.ErrConstraint:
+				status, code, detail = http.StatusConflict, codeConstraintViolation, "The change violates a database constraint"
+			case sqlite3.ErrBusy, sqlite3.ErrLocked:
+				status, code, detail = http.StatusServiceUnavailable, codeDatabaseBusy, "The database is busy, try again later"
+			}
+		}
+	}
+
+	p := newProblem(status, code, detail)
+	p.err = err
+	return p
+}
+
+func toProblem(err error) *Problem {
+	var p *Problem
+	var validationErrs validator.ValidationErrors
+	var fieldErr *FieldError
+	var httpErr *echo.HTTPError
+
+	switch {
+	case errors.As(err, &p):
+		return p
+	case errors.As(err, &validationErrs):
+		errs := make([]FieldError, len(validationErrs))
+		for i, fe := range validationErrs {
+			// Drop the struct name from Post.tags[0].name.
+			_, field, _ := strings.Cut(fe.Namespace(), ".")
+			errs[i] = FieldError{Field: field, Code: fe.Tag(), Message: validationMessage(fe)}
+		}
+		return validationFailed(errs...)
+	case errors.As(err, &fieldErr):
+		return validationFailed(*fieldErr)
+	case errors.As(err, &httpErr):
+		detail, ok := httpErr.Message.(string)
+		if !ok {
+			detail = fmt.Sprint(httpErr.Message)
+		}
+		return newProblem(httpErr.Code, "", detail)
+	}
+	return newProblem(http.StatusInternalServerError, "", "")
+}
+
+func validationMessage(fe validator.FieldError) string {
+	unit := "characters"
+	if fe.Kind() != reflect.String {
+		unit = "items"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return "must be at most " + fe.Param() + " " + unit
+	case "min":
+		return "must be at least " + fe.Param() + " " + unit
+	case "http_url":
+		return "must be an http or https URL"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	}
+	return "is invalid"
+}
+
+// handleError is the Echo HTTPErrorHandler. Every error leaves the API as
+// application/problem+json.
+func (h *Handler) handleError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := toProblem(err)
+	var httpErr *echo.HTTPError
+	if p.Status >= http.StatusInternalServerError && p.err == nil && !errors.As(err, &httpErr) {
+		c.Logger().Error(err)
+	}
+
+	out := *p
+	out.Instance = c.Request().URL.Path
+	if out.Type == "" {
+		out.Type = h.Config.BaseURL + "/problems/" + out.Code
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(out.Status)
+	} else {
+		var body []byte
+		if body, err = json.Marshal(out); err == nil {
+			err = c.Blob(out.Status, mimeProblem, body)
+		}
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
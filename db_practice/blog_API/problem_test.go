@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleAuthor)
+
+	rec := s.do(http.MethodPost, "/posts", author, map[string]any{"title": "", "content": "x", "status": "gone"})
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != mimeProblem {
+		t.Fatalf("invalid post = %d %s, want a 400 problem", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	p := decodeJSON[Problem](t, rec)
+	if p.Code != codeValidationFailed || p.Instance != "/posts" || p.Type != "https://blog.example/problems/validation_failed" {
+		t.Errorf("problem = %+v", p)
+	}
+	fields := map[string]string{}
+	for _, e := range p.Errors {
+		fields[e.Field] = e.Code
+	}
+	if fields["title"] != "required" || fields["status"] != "oneof" {
+		t.Errorf("field errors = %+v, want title required and status oneof", p.Errors)
+	}
+
+	rec = s.do(http.MethodGet, "/posts/999", "", nil)
+	p = decodeJSON[Problem](t, rec)
+	if rec.Code != http.StatusNotFound || p.Status != http.StatusNotFound || p.Type != "about:blank" || p.Code != "not_found" {
+		t.Errorf("missing post = %d %+v", rec.Code, p)
+	}
+
+	// Echo's own errors, such as an unknown route, are problems too.
+	rec = s.do(http.MethodGet, "/nowhere", "", nil)
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != mimeProblem {
+		t.Errorf("unknown route = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
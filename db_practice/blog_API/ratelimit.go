@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Rate limit groups. Every route falls into one of them, see rateLimitGroup.
+const (
+	rateLimitAuth  = "auth"
+	rateLimitRead  = "read"
+	rateLimitWrite = "write"
+)
+
+// RateLimit allows Requests per Period on average, in bursts of up to Burst.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (l RateLimit) enabled() bool { return l.Requests > 0 && l.Period > 0 }
+
+func (l RateLimit) perSecond() float64 { return float64(l.Requests) / l.Period.Seconds() }
+
+// parseRateLimit reads "120/1m" or "120/1m:20", where the part after the
+// colon is the burst. "off" disables the limit.
+func parseRateLimit(s string) (RateLimit, error) {
+	if s == "off" {
+		return RateLimit{}, nil
+	}
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	count, period, ok := strings.Cut(rate, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want requests/period", s)
+	}
+
+	var l RateLimit
+	var err error
+	if l.Requests, err = strconv.Atoi(count); err != nil || l.Requests <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, requests must be a positive number", s)
+	}
+	if l.Period, err = time.ParseDuration(period); err != nil || l.Period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, period must be a positive duration", s)
+	}
+	l.Burst = l.Requests
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q, burst must be a positive number", s)
+		}
+	}
+	return l, nil
+}
+
+// RateLimitResult is the state of a bucket after a request was counted.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, when denied
+}
+
+// RateLimitStore keeps the token buckets. MemoryRateLimitStore is enough for
+// a single instance; a shared store is needed once the API runs replicated.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore. Buckets that have
+// refilled completely are dropped, so idle clients don't use memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+	rate, capacity := limit.perSecond(), float64(limit.Burst)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	var result RateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// rateLimitGroup puts the credential endpoints in their own, tight group
+// and splits everything else into reads and writes.
+func rateLimitGroup(c echo.Context) string {
+	if strings.HasPrefix(c.Path(), "/auth/") {
+		return rateLimitAuth
+	}
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return rateLimitRead
+	}
+	return rateLimitWrite
+}
+
+// rateLimit limits requests per route group, keyed by the authenticated user
+// or else the client IP. It runs after authenticate so it can see the user.
+// When the store fails, requests are let through rather than rejected.
+func (h *Handler) rateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if probePaths[c.Path()] {
+			return next(c)
+		}
+		group := rateLimitGroup(c)
+		limit, ok := h.Config.RateLimits[group]
+		if !ok || !limit.enabled() {
+			return next(c)
+		}
+
+		key := group + ":ip:" + c.RealIP()
+		if user := currentUser(c); user != nil {
+			key = group + ":user:" + strconv.FormatUint(uint64(user.ID), 10)
+		}
+
+		result, err := h.RateLimiter.Take(c.Request().Context(), key, limit)
+		if err != nil {
+			c.Logger().Errorf("Error checking rate limit for %s: %v", key, err)
+			return next(c)
+		}
+
+		header := c.Response().Header()
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, ceilSeconds(limit.Period), limit.Burst))
+		header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			header.Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded, retry in "+strconv.Itoa(ceilSeconds(result.RetryAfter))+" seconds")
+		}
+		return next(c)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitsFromEnv reads BLOG_RATE_LIMIT_AUTH, BLOG_RATE_LIMIT_READ and
+// BLOG_RATE_LIMIT_WRITE on top of the defaults.
+func rateLimitsFromEnv(defaults map[string]RateLimit) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(defaults))
+	for group, def := range defaults {
+		limits[group] = def
+		s := stringEnv("BLOG_RATE_LIMIT_"+strings.ToUpper(group), "")
+		if s == "" {
+			continue
+		}
+		l, err := parseRateLimit(s)
+		if err != nil {
+			return nil, fmt.Errorf("BLOG_RATE_LIMIT_%s: %w", strings.ToUpper(group), err)
+		}
+		limits[group] = l
+	}
+	return limits, nil
+}
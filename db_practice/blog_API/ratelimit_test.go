@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for s, want := range map[string]RateLimit{
+		"120/1m":  {Requests: 120, Period: time.Minute, Burst: 120},
+		"10/1s:3": {Requests: 10, Period: time.Second, Burst: 3},
+		"off":     {},
+	} {
+		if got, err := parseRateLimit(s); err != nil || got != want {
+			t.Errorf("parseRateLimit(%q) = %+v, %v, want %+v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "120", "0/1m", "120/soon", "120/-1m", "120/1m:0", "x/1m"} {
+		if _, err := parseRateLimit(s); err == nil {
+			t.Errorf("parseRateLimit(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.Config.RateLimits = map[string]RateLimit{
+		rateLimitAuth: {Requests: 1, Period: time.Minute, Burst: 2},
+		rateLimitRead: {Requests: 20, Period: time.Second, Burst: 1},
+	}
+	login := func() int {
+		return s.do(http.MethodPost, "/auth/login", "", credentials{Username: "nobody", Password: "wrong password"}).Code
+	}
+
+	if code := login(); code != http.StatusUnauthorized {
+		t.Fatalf("first login = %d, want 401", code)
+	}
+	rec := s.do(http.MethodPost, "/auth/login", "", credentials{Username: "nobody", Password: "wrong password"})
+	for header, want := range map[string]string{
+		"RateLimit-Policy":    "1;w=60;burst=2",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if reset, _ := strconv.Atoi(rec.Header().Get("RateLimit-Reset")); reset < 60 || reset > 120 {
+		t.Errorf("RateLimit-Reset = %q, want the time to refill two requests", rec.Header().Get("RateLimit-Reset"))
+	}
+
+	rec = s.do(http.MethodPost, "/auth/login", "", credentials{Username: "nobody", Password: "wrong password"})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login over the limit = %d, want 429", rec.Code)
+	}
+	if retry, _ := strconv.Atoi(rec.Header().Get("Retry-After")); retry < 1 || retry > 60 {
+		t.Errorf("Retry-After = %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Groups have their own buckets, and groups without a limit have none.
+	if rec := s.do(http.MethodGet, "/posts", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("read after the auth group ran out = %d, want 200", rec.Code)
+	}
+	if rec := s.do(http.MethodGet, "/posts", "", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second read with a burst of 1 = %d, want 429", rec.Code)
+	}
+	author := s.login(t, "writer", RoleAuthor)
+	if rec := s.do(http.MethodGet, "/posts", author, nil); rec.Code != http.StatusOK {
+		t.Errorf("read by a user = %d, want 200 from the user's own bucket", rec.Code)
+	}
+	rec = s.do(http.MethodPost, "/posts", author, map[string]any{"title": "Unlimited", "content": "x"})
+	if rec.Code != http.StatusCreated || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("write without a limit = %d with RateLimit-Limit %q", rec.Code, rec.Header().Get("RateLimit-Limit"))
+	}
+
+	// 20 per second refills a request every 50ms.
+	time.Sleep(60 * time.Millisecond)
+	if rec := s.do(http.MethodGet, "/posts", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("read after the bucket refilled = %d, want 200", rec.Code)
+	}
+}
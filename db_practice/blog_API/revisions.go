@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PostRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PostID    uint      `json:"post_id" gorm:"not null;uniqueIndex:idx_post_revision"`
+	Revision  int       `json:"revision" gorm:"not null;uniqueIndex:idx_post_revision"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	EditorID  uint      `json:"editor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *PostRevision) text() string {
+	return r.Title + "\n\n" + r.Content
+}
+
+// recordRevision snapshots post as its next revision. Posts written before
+// revisions existed get their previous state saved first as revision 1, so
+// nothing is lost on their first update.
+func recordRevision(tx *gorm.DB, before, post *Post, editorID uint) error {
+	var latest int
+	err := tx.Model(&PostRevision{}).Where("post_id = ?", post.ID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	if latest == 0 && before != nil {
+		latest++
+		base := &PostRevision{PostID: before.ID, Revision: latest, Title: before.Title, Content: before.Content, EditorID: before.AuthorID}
+		if err := tx.Create(base).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&PostRevision{
+		PostID:   post.ID,
+		Revision: latest + 1,
+		Title:    post.Title,
+		Content:  post.Content,
+		EditorID: editorID,
+	}).Error
+}
+
+// findEditablePost loads the post in the URL for a caller who may modify it.
+// The error is the response to send when there is no such post or the
+// caller may not modify it.
+func (h *Handler) findEditablePost(c echo.Context) (*Post, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
+	}
+
+	post := new(Post)
+	if err := h.DB.Preload("Tags").First(post, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Post not found")
+		}
+		c.Logger().Errorf("Database error fetching post %d: %v", id, err)
+		return nil, dbError(err, "Failed to fetch post")
+	}
+
+	if err := authorizeOwned(currentUser(c), post.AuthorID, PermEditOwnPosts, PermEditAnyPost); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (h *Handler) findRevision(c echo.Context, postID uint, revStr string) (*PostRevision, error) {
+	rev, err := strconv.Atoi(revStr)
+	if err != nil || rev < 1 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid revision format")
+	}
+
+	revision := new(PostRevision)
+	if err := h.DB.Where("post_id = ? AND revision = ?", postID, rev).First(revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Revision not found")
+		}
+		c.Logger().Errorf("Database error fetching revision %d of post %d: %v", rev, postID, err)
+		return nil, dbError(err, "Failed to fetch revision")
+	}
+	return revision, nil
+}
+
+func (h *Handler) getRevisions(c echo.Context) error {
+	post, err := h.findEditablePost(c)
+	if post == nil {
+		return err
+	}
+
+	revisions := []PostRevision{}
+	if err := h.DB.Where("post_id = ?", post.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		c.Logger().Errorf("Database error fetching revisions of post %d: %v", post.ID, err)
+		return dbError(err, "Failed to fetch revisions")
+	}
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// diffRevision returns a unified diff from ?against= (the previous revision
+// by default) to :rev.
+func (h *Handler) diffRevision(c echo.Context) error {
+	post, err := h.findEditablePost(c)
+	if post == nil {
+		return err
+	}
+	to, err := h.findRevision(c, post.ID, c.Param("rev"))
+	if to == nil {
+		return err
+	}
+
+	against := c.QueryParam("against")
+	if against == "" {
+		if to.Revision == 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Revision 1 has no previous revision, pass ?against=")
+		}
+		against = strconv.Itoa(to.Revision - 1)
+	}
+	from, err := h.findRevision(c, post.ID, against)
+	if from == nil {
+		return err
+	}
+
+	diff := unifiedDiff("revision "+strconv.Itoa(from.Revision), "revision "+strconv.Itoa(to.Revision), from.text(), to.text())
+	return c.Blob(http.StatusOK, "text/x-diff; charset=utf-8", []byte(diff))
+}
+
+func (h *Handler) restoreRevision(c echo.Context) error {
+	post, err := h.findEditablePost(c)
+	if post == nil {
+		return err
+	}
+	revision, err := h.findRevision(c, post.ID, c.Param("rev"))
+	if revision == nil {
+		return err
+	}
+
+	before := *post
+	post.Title, post.Content = revision.Title, revision.Content
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return saveUpdatedPost(tx, &before, post, nil, currentUser(c).ID)
+	})
+	if errors.Is(err, errPostGone) {
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	}
+	if errors.Is(err, errStaleVersion) {
+		return staleVersion(c)
+	}
+	if err != nil {
+		c.Logger().Errorf("Database error restoring revision %d of post %d: %v", revision.Revision, post.ID, err)
+		return dbError(err, "Failed to restore revision")
+	}
+
+	c.Response().Header().Set("ETag", postETag(post))
+	return c.JSON(http.StatusOK, post)
+}
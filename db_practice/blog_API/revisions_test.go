@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	if diff := unifiedDiff("a", "b", "same\ntext", "same\ntext"); diff != "" {
+		t.Errorf("diff of equal texts = %q, want nothing", diff)
+	}
+
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprint("line ", i))
+	}
+	from := strings.Join(lines, "\n")
+	lines[1], lines[17] = "changed 2", "changed 18"
+	diff := unifiedDiff("a", "b", from, strings.Join(lines, "\n"))
+	if !strings.HasPrefix(diff, "--- a\n+++ b\n@@ -1,5 +1,5 @@\n line 1\n-line 2\n+changed 2\n") {
+		t.Errorf("diff starts with\n%s", diff)
+	}
+	if hunks := strings.Count(diff, "\n@@ "); hunks != 2 {
+		t.Errorf("diff has %d hunks, want 2 for changes far apart:\n%s", hunks, diff)
+	}
+}
+
+func TestRevisionDiffAndRestore(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleAuthor)
+	other := s.login(t, "other", RoleAuthor)
+	post := s.createPost(t, author, map[string]any{"title": "Recipe", "content": "flour\nsugar\neggs"})
+	path := fmt.Sprintf("/posts/%d", post.ID)
+	if rec := s.do(http.MethodPut, path, author, map[string]any{"title": "Recipe", "content": "flour\nbutter\neggs"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+	}
+
+	rec := s.do(http.MethodGet, path+"/revisions/2/diff", author, nil)
+	want := "--- revision 1\n+++ revision 2\n@@ -1,5 +1,5 @@\n Recipe\n \n flour\n-sugar\n+butter\n eggs\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("diff = %d\n%s\nwant\n%s", rec.Code, rec.Body, want)
+	}
+	if rec := s.do(http.MethodGet, path+"/revisions/1/diff", author, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("diff of revision 1 without against = %d, want 400", rec.Code)
+	}
+	if rec := s.do(http.MethodGet, path+"/revisions/2/diff?against=9", author, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("diff against a missing revision = %d, want 404", rec.Code)
+	}
+	if rec := s.do(http.MethodGet, path+"/revisions", other, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("revisions as another author = %d, want 403", rec.Code)
+	}
+
+	rec = s.do(http.MethodPost, path+"/revisions/1/restore", author, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore = %d %s", rec.Code, rec.Body)
+	}
+	if restored := decodeJSON[Post](t, rec); restored.Content != "flour\nsugar\neggs" {
+		t.Errorf("restored content = %q", restored.Content)
+	}
+
+	// Restoring adds a revision instead of rewriting history.
+	revisions := decodeJSON[[]PostRevision](t, s.do(http.MethodGet, path+"/revisions", author, nil))
+	if len(revisions) != 3 || revisions[0].Revision != 3 || revisions[0].Content != "flour\nsugar\neggs" {
+		t.Fatalf("revisions after restore = %+v", revisions)
+	}
+	if rec := s.do(http.MethodGet, path+"/revisions/3/diff?against=1", author, nil); rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("diff of the restored revision against the original = %d %q, want empty", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag, which
+// the Makefile passes:
+//
+//	go build -tags sqlite_fts5 .
+//
+// Without it the server refuses to start, see requireFTS5.
+
+// postsFTSTable and the triggers that keep it in sync are created by
+// migrations/0002_search.up.sql.
+const postsFTSTable = "posts_fts"
+
+type searchResult struct {
+	Post
+	Score          float64 `json:"score"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+// requireFTS5 fails when SQLite was built without FTS5, so that a plain
+// "go build" can't produce a server whose search is silently missing.
+func requireFTS5(db *gorm.DB) error {
+	var enabled bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if !enabled {
+		return errors.New("SQLite was built without FTS5, build with -tags sqlite_fts5 (see Makefile)")
+	}
+	return nil
+}
+
+func rebuildSearchIndex(db *gorm.DB) error {
+	return db.Exec("INSERT INTO posts_fts(posts_fts) VALUES ('rebuild')").Error
+}
+
+// buildFTSQuery turns user input into a safe FTS5 MATCH expression. Bare words
+// and "quoted phrases" are ANDed together, and a trailing * makes either a
+// prefix match. Everything else is quoted so it can't be read as FTS5 syntax.
+func buildFTSQuery(input string) (string, error) {
+	var terms []string
+	addTerm := func(text string, prefix bool) {
+		text = strings.TrimSpace(strings.ReplaceAll(text, `"`, ""))
+		if text == "" {
+			return
+		}
+		term := `"` + text + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				addTerm(rest[1:], false)
+				break
+			}
+			phrase := rest[1 : end+1]
+			rest = rest[end+2:]
+			prefix := strings.HasPrefix(rest, "*")
+			if prefix {
+				rest = rest[1:]
+			}
+			addTerm(phrase, prefix)
+		} else {
+			end := strings.IndexAny(rest, " \t\n\"")
+			if end < 0 {
+				end = len(rest)
+			}
+			word := rest[:end]
+			rest = rest[end:]
+			addTerm(strings.TrimRight(word, "*"), strings.HasSuffix(word, "*"))
+		}
+		rest = strings.TrimLeft(rest, " \t\n")
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("Search query cannot be empty")
+	}
+	return strings.Join(terms, " "), nil
+}
+
+func (h *Handler) searchPosts(c echo.Context) error {
+	match, err := buildFTSQuery(c.QueryParam("q"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	limit := defaultPageLimit
+	if s := c.QueryParam("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit, must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+	}
+	offset := 0
+	if s := c.QueryParam("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid offset")
+		}
+	}
+
+	if !h.DB.Migrator().HasTable(postsFTSTable) {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Full-text search is not available")
+	}
+
+	results := []searchResult{}
+	err = h.DB.Raw(`SELECT posts.*,
+			-bm25(posts_fts, 10.0, 1.0) AS score,
+			highlight(posts_fts, 0, '<mark>', '</mark>') AS title_highlight,
+			snippet(posts_fts, 1, '<mark>', '</mark>', '…', 24) AS snippet
+		FROM posts_fts
+		JOIN posts ON posts.id = posts_fts.rowid
+		WHERE posts_fts MATCH ? AND posts.deleted_at IS NULL AND posts.status = ?
+		ORDER BY score DESC, posts.id DESC
+		LIMIT ? OFFSET ?`, match, StatusPublished, limit, offset).Scan(&results).Error
+	if err != nil {
+		c.Logger().Errorf("Database error searching posts for %q: %v", match, err)
+		return dbError(err, "Failed to search posts")
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+func (h *Handler) rebuildSearch(c echo.Context) error {
+	if !h.DB.Migrator().HasTable(postsFTSTable) {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Full-text search is not available")
+	}
+
+	if err := rebuildSearchIndex(h.DB); err != nil {
+		c.Logger().Errorf("Database error rebuilding search index: %v", err)
+		return dbError(err, "Failed to rebuild search index")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
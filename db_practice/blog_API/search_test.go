@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestBuildFTSQuery(t *testing.T) {
+	for input, want := range map[string]string{
+		"go":                   `"go"`,
+		"  go   sqlite ":       `"go" "sqlite"`,
+		"gor*":                 `"gor"*`,
+		`"full text" search`:   `"full text" "search"`,
+		`"full te"*`:           `"full te"*`,
+		`"unterminated phrase`: `"unterminated phrase"`,
+		"title:x OR NEAR(a b)": `"title:x" "OR" "NEAR(a" "b)"`,
+	} {
+		got, err := buildFTSQuery(input)
+		if err != nil || got != want {
+			t.Errorf("buildFTSQuery(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "   ", `""`, "*"} {
+		if _, err := buildFTSQuery(input); err == nil {
+			t.Errorf("buildFTSQuery(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login(t, "writer", RoleEditor)
+	inTitle := s.createPost(t, token, map[string]any{"title": "Gophers everywhere", "content": "A post about Go.", "status": "published"})
+	inContent := s.createPost(t, token, map[string]any{"title": "Databases", "content": "SQLite and gophers.", "status": "published"})
+	s.createPost(t, token, map[string]any{"title": "Unrelated", "content": "Nothing to see.", "status": "published"})
+
+	search := func(q string) []searchResult {
+		t.Helper()
+		rec := s.do(http.MethodGet, "/posts/search?q="+url.QueryEscape(q), "", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("search %q = %d %s", q, rec.Code, rec.Body)
+		}
+		return decodeJSON[[]searchResult](t, rec)
+	}
+
+	results := search("gopher*")
+	if len(results) != 2 || results[0].ID != inTitle.ID || results[1].ID != inContent.ID {
+		t.Fatalf("search gopher* = %+v, want the title match ranked first", results)
+	}
+	if results[0].TitleHighlight != "<mark>Gophers</mark> everywhere" {
+		t.Errorf("title highlight = %q", results[0].TitleHighlight)
+	}
+
+	// The index follows updates and deletes.
+	s.do(http.MethodPut, fmt.Sprintf("/posts/%d", inContent.ID), token, map[string]any{"title": "Databases", "content": "Only SQLite.", "status": "published"})
+	s.do(http.MethodDelete, fmt.Sprintf("/posts/%d", inTitle.ID), token, nil)
+	if results := search("gopher*"); len(results) != 0 {
+		t.Errorf("search gopher* after update and delete = %+v, want nothing", results)
+	}
+	if results := search("sqlite"); len(results) != 1 || results[0].ID != inContent.ID {
+		t.Errorf("search sqlite = %+v, want post %d", results, inContent.ID)
+	}
+
+	if rec := s.do(http.MethodGet, "/posts/search?q=%20", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty search = %d, want 400", rec.Code)
+	}
+}
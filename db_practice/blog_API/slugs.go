@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const maxSlugLength = 80
+
+// PostSlug is a slug a post used to have. Old slugs keep redirecting to the
+// post so links shared before a rename stay valid.
+type PostSlug struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	PostID    uint      `json:"post_id" gorm:"not null;index"`
+	Slug      string    `json:"slug" gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// makeSlug turns text into a URL slug, transliterating non-ASCII letters.
+func makeSlug(text string) string {
+	s := slug.Make(text)
+	if len(s) > maxSlugLength {
+		s = s[:maxSlugLength]
+		if i := strings.LastIndexByte(s, '-'); i > 0 {
+			s = s[:i]
+		}
+		s = strings.Trim(s, "-")
+	}
+	if s == "" {
+		s = "post"
+	}
+	return s
+}
+
+// slugTaken reports whether s is used, now or in the past, by a post other
+// than postID. Trashed posts keep their slugs so they can be restored.
+func slugTaken(tx *gorm.DB, s string, postID uint) (bool, error) {
+	var count int64
+	err := tx.Unscoped().Model(&Post{}).Where("slug = ? AND id <> ?", s, postID).Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+	err = tx.Model(&PostSlug{}).Where("slug = ? AND post_id <> ?", s, postID).Count(&count).Error
+	return count > 0, err
+}
+
+// uniqueSlug returns base, or base with the first free numeric suffix.
+func uniqueSlug(tx *gorm.DB, base string, postID uint) (string, error) {
+	candidate := base
+	for n := 2; ; n++ {
+		taken, err := slugTaken(tx, candidate, postID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// assignSlug sets post.Slug from the requested slug, or from the title when
+// none was given, making it unique.
+func assignSlug(tx *gorm.DB, post *Post) error {
+	base := post.Slug
+	if strings.TrimSpace(base) == "" {
+		base = post.Title
+	}
+	s, err := uniqueSlug(tx, makeSlug(base), post.ID)
+	if err != nil {
+		return err
+	}
+	post.Slug = s
+	return nil
+}
+
+// updateSlug resolves a changed slug and keeps the old one as a redirect. A
+// post moving back to one of its own old slugs reclaims it. Changing only the
+// title keeps the slug, so links don't break; an empty slug asks for a new
+// one from the current title.
+func updateSlug(tx *gorm.DB, before, post *Post) error {
+	if before == nil || post.Slug == before.Slug {
+		return nil
+	}
+	if err := assignSlug(tx, post); err != nil {
+		return err
+	}
+	if post.Slug == before.Slug {
+		return nil
+	}
+	if err := tx.Where("post_id = ? AND slug = ?", post.ID, post.Slug).Delete(&PostSlug{}).Error; err != nil {
+		return err
+	}
+	if before.Slug == "" {
+		return nil
+	}
+	return tx.Create(&PostSlug{PostID: post.ID, Slug: before.Slug}).Error
+}
+
+// assignMissingSlugs gives a slug to posts created before slugs existed.
+func assignMissingSlugs(db *gorm.DB) error {
+	var posts []Post
+	err := db.Unscoped().Select("id", "title").Where("slug IS NULL OR slug = ''").Order("id").Find(&posts).Error
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := assignSlug(tx, &posts[i]); err != nil {
+				return err
+			}
+			return tx.Unscoped().Model(&Post{}).Where("id = ?", posts[i].ID).UpdateColumn("slug", posts[i].Slug).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) getPostBySlug(c echo.Context) error {
+	s := c.Param("slug")
+
+	var post Post
+	err := h.DB.Preload("Tags").Where("slug = ?", s).First(&post).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return h.redirectOldSlug(c, s)
+	}
+	if err != nil {
+		c.Logger().Errorf("Database error fetching post by slug %q: %v", s, err)
+		return dbError(err, "Failed to fetch post")
+	}
+
+	if !canView(currentUser(c), &post) {
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	}
+
+	return writePost(c, &post)
+}
+
+// redirectOldSlug sends a permanent redirect to the current slug of the post
+// that used to be reachable under s.
+func (h *Handler) redirectOldSlug(c echo.Context, s string) error {
+	var post Post
+	err := h.DB.Select("posts.id", "posts.slug", "posts.status", "posts.author_id").
+		Joins("JOIN post_slugs ON post_slugs.post_id = posts.id").
+		Where("post_slugs.slug = ?", s).First(&post).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+		}
+		c.Logger().Errorf("Database error resolving old slug %q: %v", s, err)
+		return dbError(err, "Failed to fetch post")
+	}
+
+	if !canView(currentUser(c), &post) {
+		return echo.NewHTTPError(http.StatusNotFound, "Post not found")
+	}
+	return c.Redirect(http.StatusMovedPermanently, "/posts/by-slug/"+post.Slug)
+}
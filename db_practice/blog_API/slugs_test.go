@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMakeSlug(t *testing.T) {
+	for text, want := range map[string]string{
+		"Hello, World!":    "hello-world",
+		"Crème brûlée 101": "creme-brulee-101",
+		"¿¡!?":             "post",
+	} {
+		if got := makeSlug(text); got != want {
+			t.Errorf("makeSlug(%q) = %q, want %q", text, got, want)
+		}
+	}
+	long := makeSlug(strings.Repeat("seven ", 20))
+	if len(long) > maxSlugLength || strings.HasSuffix(long, "-") || !strings.HasSuffix(long, "seven") {
+		t.Errorf("makeSlug of a long title = %q, want whole words within %d bytes", long, maxSlugLength)
+	}
+}
+
+func TestSlugs(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleEditor)
+	publish := func(title string) Post {
+		return s.createPost(t, author, map[string]any{"title": title, "content": "x", "status": StatusPublished})
+	}
+	update := func(post Post, body map[string]any) Post {
+		t.Helper()
+		body["content"] = "x"
+		body["status"] = StatusPublished
+		rec := s.do(http.MethodPut, fmt.Sprintf("/posts/%d", post.ID), author, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT = %d %s", rec.Code, rec.Body)
+		}
+		return decodeJSON[Post](t, rec)
+	}
+
+	first, second := publish("Hello World"), publish("Hello, world")
+	if first.Slug != "hello-world" || second.Slug != "hello-world-2" {
+		t.Errorf("colliding slugs = %q and %q, want hello-world and hello-world-2", first.Slug, second.Slug)
+	}
+
+	// A new title alone keeps the slug, an empty slug regenerates it.
+	first = update(first, map[string]any{"title": "Goodbye World"})
+	if first.Slug != "hello-world" {
+		t.Errorf("slug after a title change = %q, want it kept", first.Slug)
+	}
+	first = update(first, map[string]any{"title": "Goodbye World", "slug": ""})
+	if first.Slug != "goodbye-world" {
+		t.Errorf("slug after clearing it = %q, want goodbye-world", first.Slug)
+	}
+
+	rec := s.do(http.MethodGet, "/posts/by-slug/hello-world", "", nil)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/posts/by-slug/goodbye-world" {
+		t.Errorf("GET old slug = %d to %q, want 301 to the new slug", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := s.do(http.MethodGet, "/posts/by-slug/goodbye-world", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET current slug = %d", rec.Code)
+	}
+
+	// Old slugs stay reserved for their post, which can take them back.
+	third := publish("Hello World")
+	if third.Slug != "hello-world-3" {
+		t.Errorf("slug of a new post = %q, want hello-world-3 since hello-world redirects", third.Slug)
+	}
+	first = update(first, map[string]any{"title": "Goodbye World", "slug": "hello-world"})
+	if first.Slug != "hello-world" {
+		t.Errorf("reclaimed slug = %q, want hello-world", first.Slug)
+	}
+	rec = s.do(http.MethodGet, "/posts/by-slug/goodbye-world", "", nil)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/posts/by-slug/hello-world" {
+		t.Errorf("GET slug given up = %d to %q, want 301 to hello-world", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := s.do(http.MethodGet, "/posts/by-slug/hello-world", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET reclaimed slug = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+var errLoginRequired = errors.New("Login required to include drafts")
+
+func isPostStatus(s string) bool {
+	switch s {
+	case StatusDraft, StatusScheduled, StatusPublished, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// prepareStatus validates the workflow fields of a post before it is saved
+// and stamps PublishedAt the first time it goes live.
+func prepareStatus(post *Post) error {
+	if post.PublishAt != nil {
+		t := post.PublishAt.Local()
+		post.PublishAt = &t
+	}
+
+	switch post.Status {
+	case StatusScheduled:
+		if post.PublishAt == nil {
+			return &FieldError{Field: "publish_at", Code: "required", Message: "is required for scheduled posts"}
+		}
+	case StatusPublished:
+		if post.PublishedAt == nil {
+			now := time.Now()
+			post.PublishedAt = &now
+		}
+	}
+	return nil
+}
+
+// visiblePosts limits q to published posts, plus the posts the viewer may
+// still work on when drafts were asked for.
+func visiblePosts(q *gorm.DB, viewer *authUser, includeDrafts bool) *gorm.DB {
+	switch {
+	case !includeDrafts || viewer == nil:
+		return q.Where("posts.status = ?", StatusPublished)
+	case can(viewer, PermReadDrafts):
+		return q
+	default:
+		return q.Where("posts.status = ? OR posts.author_id = ?", StatusPublished, viewer.ID)
+	}
+}
+
+func canView(viewer *authUser, post *Post) bool {
+	return post.Status == StatusPublished || can(viewer, PermReadDrafts) || (viewer != nil && viewer.ID == post.AuthorID)
+}
+
+func publishScheduledPosts(db *gorm.DB, now time.Time) (int64, error) {
+	var published int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Model(&Post{}).Where("status = ? AND publish_at <= ?", StatusScheduled, now).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		// The predicate is checked again, since a post may have been edited
+		// between finding it and updating it.
+		result := tx.Model(&Post{}).Where("id IN ? AND status = ? AND publish_at <= ?", ids, StatusScheduled, now).
+			Updates(map[string]any{
+				"status":       StatusPublished,
+				"published_at": gorm.Expr("publish_at"),
+				"version":      gorm.Expr("version + 1"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		published = result.RowsAffected
+
+		var posts []Post
+		if err := tx.Preload("Tags").Where("id IN ? AND status = ?", ids, StatusPublished).Find(&posts).Error; err != nil {
+			return err
+		}
+		for i := range posts {
+			if err := enqueueEvent(tx, EventPostPublished, StatusScheduled, &posts[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return published, err
+}
+
+// runPublisher flips scheduled posts to published every interval until ctx
+// is done, purging cache whenever a post went live.
+func runPublisher(ctx context.Context, db *gorm.DB, interval time.Duration, cache *ResponseCache) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := publishScheduledPosts(db.WithContext(ctx), time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to publish scheduled posts: %v", err)
+		} else if n > 0 {
+			cache.Purge()
+			log.Printf("Published %d scheduled posts", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPublishScheduledPosts(t *testing.T) {
+	s := newTestServer(t)
+	token := s.login(t, "writer", RoleEditor)
+	publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	due := s.createPost(t, token, map[string]any{"title": "Due", "content": "x", "status": StatusScheduled, "publish_at": publishAt})
+	later := s.createPost(t, token, map[string]any{"title": "Later", "content": "x", "status": StatusScheduled, "publish_at": publishAt.Add(time.Hour)})
+	draft := s.createPost(t, token, map[string]any{"title": "Draft", "content": "x", "publish_at": publishAt})
+
+	n, err := publishScheduledPosts(s.DB, publishAt.Add(time.Minute))
+	if err != nil || n != 1 {
+		t.Fatalf("publishScheduledPosts = %d, %v, want 1 post", n, err)
+	}
+	for _, want := range []struct {
+		post   Post
+		status string
+	}{{due, StatusPublished}, {later, StatusScheduled}, {draft, StatusDraft}} {
+		var post Post
+		if err := s.DB.First(&post, want.post.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if post.Status != want.status {
+			t.Errorf("%s has status %q, want %q", post.Title, post.Status, want.status)
+		}
+		if want.status == StatusPublished && (post.PublishedAt == nil || !post.PublishedAt.Equal(publishAt)) {
+			t.Errorf("%s was published at %v, want its publish_at %v", post.Title, post.PublishedAt, publishAt)
+		}
+	}
+
+	// A second run finds nothing left to do.
+	if n, err := publishScheduledPosts(s.DB, publishAt.Add(time.Minute)); err != nil || n != 0 {
+		t.Errorf("second run = %d, %v, want 0", n, err)
+	}
+}
+
+func TestDraftsAreHidden(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "writer", RoleEditor)
+	other := s.login(t, "reader", RoleAuthor)
+	draft := s.createPost(t, author, map[string]any{"title": "Draft", "content": "x"})
+	s.createPost(t, author, map[string]any{"title": "Live", "content": "x", "status": StatusPublished})
+	path := fmt.Sprintf("/posts/%d", draft.ID)
+
+	for _, token := range []string{"", other} {
+		if rec := s.do(http.MethodGet, path, token, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET draft as someone else = %d, want 404", rec.Code)
+		}
+	}
+	if rec := s.do(http.MethodGet, path, author, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET draft as its author = %d, want 200", rec.Code)
+	}
+
+	if p := getPage(t, s, nil); len(p.Data) != 1 || p.Data[0].Title != "Live" {
+		t.Errorf("GET /posts = %v, want only the published post", pageIDs(p))
+	}
+	if rec := s.do(http.MethodGet, "/posts?include=drafts", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("include=drafts without login = %d, want 401", rec.Code)
+	}
+	rec := s.do(http.MethodGet, "/posts?include=drafts", author, nil)
+	if p := decodeJSON[page[Post]](t, rec); len(p.Data) != 2 {
+		t.Errorf("include=drafts as the author = %v, want both posts", pageIDs(p))
+	}
+}
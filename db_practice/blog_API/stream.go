@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	StreamCreated = "created"
+	StreamUpdated = "updated"
+	StreamDeleted = "deleted"
+
+	// streamReset tells a client that asked to resume that the events it
+	// missed are gone, so it has to fetch /posts again.
+	streamReset = "reset"
+)
+
+const (
+	streamClientBuffer = 64
+	streamHeartbeat    = 15 * time.Second
+	streamRetry        = 3 * time.Second
+)
+
+// streamData is the data of a stream event. Post is left out for clients
+// that may not see the post, they only learn that it is gone from view.
+type streamData struct {
+	PostID     uint      `json:"post_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Post       *Post     `json:"post,omitempty"`
+}
+
+// postEvent is an event as kept in the replay buffer. Both forms of the
+// data are encoded once when it is published, not once per client.
+type postEvent struct {
+	seq    uint64
+	id     string
+	event  string
+	before *Post // the post as it was, nil if it didn't exist or was in the trash
+	post   *Post
+	full   []byte
+	hidden []byte
+}
+
+// forViewer is what viewer gets for e. A post that viewer may not see is
+// never shown. An update that hides a post viewer could see becomes a
+// deletion; changes to posts viewer never saw are left out.
+func (e *postEvent) forViewer(viewer *authUser) (event string, data []byte, ok bool) {
+	sawIt := e.before != nil && canView(viewer, e.before)
+	switch {
+	case e.event == StreamDeleted:
+		if sawIt {
+			return StreamDeleted, e.full, true
+		}
+	case canView(viewer, e.post):
+		return e.event, e.full, true
+	case sawIt:
+		return StreamDeleted, e.hidden, true
+	}
+	return "", nil, false
+}
+
+type streamClient struct {
+	events chan *postEvent
+}
+
+// streamSubscription is where a new client starts: the events it missed,
+// or a reset when they can't be replayed.
+type streamSubscription struct {
+	client  *streamClient
+	backlog []*postEvent
+	resetID string
+}
+
+// PostStream fans post changes out to the clients of /posts/stream and
+// keeps the latest of them for clients resuming with Last-Event-ID. Event
+// IDs are "<epoch>-<seq>", where the epoch changes on every start, so an
+// ID from before a restart is never mistaken for a current one.
+//
+// Publishing never waits for a client. A client whose buffer is full is
+// dropped; it reconnects and catches up from the replay buffer.
+type PostStream struct {
+	mu       sync.Mutex
+	epoch    string
+	seq      uint64
+	size     int
+	replay   []*postEvent
+	clients  map[*streamClient]struct{}
+	closed   bool
+	dropped  uint64
+	received uint64
+}
+
+func NewPostStream(replaySize int) *PostStream {
+	return &PostStream{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:    replaySize,
+		clients: make(map[*streamClient]struct{}),
+	}
+}
+
+func (s *PostStream) eventID(seq uint64) string {
+	return s.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// Subscribe registers a client. The backlog and the registration happen
+// under one lock, so no event is missed or sent twice in between. It
+// returns nil once the stream is closed.
+func (s *PostStream) Subscribe(lastEventID string) *streamSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	sub := &streamSubscription{client: &streamClient{events: make(chan *postEvent, streamClientBuffer)}}
+	s.clients[sub.client] = struct{}{}
+
+	if lastEventID == "" {
+		return sub
+	}
+	epoch, seqStr, _ := strings.Cut(lastEventID, "-")
+	last, err := strconv.ParseUint(seqStr, 10, 64)
+	oldest := s.seq + 1
+	if len(s.replay) > 0 {
+		oldest = s.replay[0].seq
+	}
+	if err != nil || epoch != s.epoch || last > s.seq || last+1 < oldest {
+		sub.resetID = s.eventID(s.seq)
+		return sub
+	}
+	for _, ev := range s.replay {
+		if ev.seq > last {
+			sub.backlog = append(sub.backlog, ev)
+		}
+	}
+	return sub
+}
+
+func (s *PostStream) Unsubscribe(client *streamClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(client)
+}
+
+// remove closes the channel of client, which ends its response. It must be
+// called with s.mu held, as publish sends under it.
+func (s *PostStream) remove(client *streamClient) {
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client.events)
+	}
+}
+
+func (s *PostStream) publish(events []*postEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ev := range events {
+		s.seq++
+		ev.seq, ev.id = s.seq, s.eventID(s.seq)
+		s.received++
+
+		if s.size > 0 {
+			s.replay = append(s.replay, ev)
+			if len(s.replay) > s.size {
+				s.replay[0] = nil
+				s.replay = s.replay[1:]
+			}
+		}
+		for client := range s.clients {
+			select {
+			case client.events <- ev:
+			default:
+				s.remove(client)
+				s.dropped++
+			}
+		}
+	}
+}
+
+// publishOutbox publishes webhook outbox events once they are committed.
+// A post that goes live records post.published right after post.created or
+// post.updated; the stream sends one event for both.
+func (s *PostStream) publishOutbox(events []OutboxEvent) {
+	var out []*postEvent
+	for i, ev := range events {
+		var kind string
+		switch ev.Event {
+		case EventPostCreated:
+			kind = StreamCreated
+		case EventPostUpdated:
+			kind = StreamUpdated
+		case EventPostDeleted:
+			kind = StreamDeleted
+		case EventPostPublished:
+			if i > 0 && events[i-1].PostID == ev.PostID && (events[i-1].Event == EventPostCreated || events[i-1].Event == EventPostUpdated) {
+				continue
+			}
+			kind = StreamUpdated
+		default:
+			continue
+		}
+
+		var payload webhookPayload
+		if err := json.Unmarshal([]byte(ev.Payload), &payload); err != nil || payload.Post == nil {
+			log.Printf("Skipping outbox event %s on the post stream: %v", ev.EventID, err)
+			continue
+		}
+		full, err := json.Marshal(streamData{PostID: ev.PostID, OccurredAt: payload.OccurredAt, Post: payload.Post})
+		if err != nil {
+			log.Printf("Skipping outbox event %s on the post stream: %v", ev.EventID, err)
+			continue
+		}
+		hidden, _ := json.Marshal(streamData{PostID: ev.PostID, OccurredAt: payload.OccurredAt})
+		var before *Post
+		if payload.PreviousStatus != "" {
+			before = new(Post)
+			*before = *payload.Post
+			before.Status = payload.PreviousStatus
+		}
+		out = append(out, &postEvent{event: kind, before: before, post: payload.Post, full: full, hidden: hidden})
+	}
+	if len(out) > 0 {
+		s.publish(out)
+	}
+}
+
+// Close ends every open stream and refuses new ones, so that a shutdown
+// doesn't wait for clients that never disconnect.
+func (s *PostStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for client := range s.clients {
+		s.remove(client)
+	}
+}
+
+// StreamStats are the counters of a PostStream since it was created.
+type StreamStats struct {
+	Clients int
+	Events  uint64
+	Dropped uint64
+}
+
+func (s *PostStream) Stats() StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StreamStats{Clients: len(s.clients), Events: s.received, Dropped: s.dropped}
+}
+
+func writeStreamEvent(w http.ResponseWriter, id, event string, data []byte) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err
+}
+
+// getPostStream sends post changes as Server-Sent Events until the client
+// goes away, falls too far behind, or the server shuts down. Drafts follow
+// the same rules as GET /posts/:id.
+func (h *Handler) getPostStream(c echo.Context) error {
+	sub := h.Stream.Subscribe(c.Request().Header.Get("Last-Event-ID"))
+	if sub == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Server is shutting down")
+	}
+	defer h.Stream.Unsubscribe(sub.client)
+
+	viewer := currentUser(c)
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(res, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return nil
+	}
+	if sub.resetID != "" {
+		if err := writeStreamEvent(res, sub.resetID, streamReset, []byte("{}")); err != nil {
+			return nil
+		}
+	}
+	for _, ev := range sub.backlog {
+		if event, data, ok := ev.forViewer(viewer); ok {
+			if err := writeStreamEvent(res, ev.id, event, data); err != nil {
+				return nil
+			}
+		}
+	}
+	res.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case ev, ok := <-sub.client.events:
+			if !ok {
+				return nil
+			}
+			event, data, show := ev.forViewer(viewer)
+			if !show {
+				continue
+			}
+			if err := writeStreamEvent(res, ev.id, event, data); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+// wakeOutbox has the outbox dispatcher look at the outbox right after a
+// write instead of on its next tick, so stream clients see changes promptly.
+func (h *Handler) wakeOutbox(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if err == nil && isWrite(c) && c.Response().Status < http.StatusBadRequest {
+			select {
+			case h.OutboxReady <- struct{}{}:
+			default:
+			}
+		}
+		return err
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TestStreamNotHeldUpByWebhooks has a receiver that never answers, and
+// checks that post changes still reach the stream while a delivery to it is
+// in flight.
+func TestStreamNotHeldUpByWebhooks(t *testing.T) {
+	db := newTestDB(t)
+
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(receiver.Close)
+	t.Cleanup(func() { close(release) })
+	if err := db.Create(&Webhook{URL: receiver.URL, Secret: "whsec_test_secret_value", Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	stream := NewPostStream(10)
+	sub := stream.Subscribe("")
+	wake, deliver := make(chan struct{}, 1), make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		runOutboxDispatcher(ctx, db, time.Hour, stream, wake, deliver)
+	}()
+	go func() {
+		defer workers.Done()
+		runWebhookWorker(ctx, db, time.Hour, deliver)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		workers.Wait()
+	})
+
+	write := func(title string) uint {
+		t.Helper()
+		post := &Post{Title: title, Content: "Body", Status: StatusPublished, Slug: title}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(post).Error; err != nil {
+				return err
+			}
+			return enqueuePostEvents(tx, nil, post)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wake <- struct{}{}
+		return post.ID
+	}
+	expect := func(id uint) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case ev := <-sub.client.events:
+				if ev.post.ID == id {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("post %d never reached the stream", id)
+			}
+		}
+	}
+
+	expect(write("first"))
+	select {
+	case <-arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was never sent")
+	}
+
+	// The worker is now stuck on the receiver.
+	for i := range 3 {
+		expect(write("next-" + strconv.Itoa(i)))
+	}
+}
+
+// TestStreamVisibility follows a post from draft to published and back, and
+// checks what an anonymous client and the author each see of it.
+func TestStreamVisibility(t *testing.T) {
+	s := newTestServer(t)
+	author := s.login(t, "ann", RoleAuthor)
+	editor := s.login(t, "ed", RoleEditor)
+	var ann User
+	if err := s.DB.Where("username = ?", "ann").First(&ann).Error; err != nil {
+		t.Fatal(err)
+	}
+	sub := s.Stream.Subscribe("")
+
+	draft := s.createPost(t, author, map[string]any{"title": "Draft", "content": "x"})
+	path := fmt.Sprintf("/posts/%d", draft.ID)
+	for _, step := range []struct {
+		token, body string
+	}{
+		{author, `{"content":"Edited"}`},
+		{editor, `{"status":"published"}`},
+		{editor, `{"status":"draft"}`},
+		{author, `{"content":"Edited again"}`},
+	} {
+		if rec := s.do(http.MethodPatch, path, step.token, step.body, "Content-Type", mimeMergePatch); rec.Code != http.StatusOK {
+			t.Fatalf("PATCH %s = %d %s", step.body, rec.Code, rec.Body)
+		}
+	}
+	if rec := s.do(http.MethodDelete, path, author, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE %s = %d %s", path, rec.Code, rec.Body)
+	}
+	for {
+		n, err := dispatchOutbox(s.DB, s.Stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	var events []*postEvent
+	for len(sub.client.events) > 0 {
+		events = append(events, <-sub.client.events)
+	}
+	seen := func(viewer *authUser) []string {
+		var kinds []string
+		for _, ev := range events {
+			if kind, _, ok := ev.forViewer(viewer); ok {
+				kinds = append(kinds, kind)
+			}
+		}
+		return kinds
+	}
+
+	for _, tt := range []struct {
+		name   string
+		viewer *authUser
+		want   []string
+	}{
+		{"anonymous", nil, []string{StreamUpdated, StreamDeleted}},
+		{"author", &authUser{ID: ann.ID, Role: RoleAuthor}, []string{StreamCreated, StreamUpdated, StreamUpdated, StreamUpdated, StreamUpdated, StreamDeleted}},
+	} {
+		if got := seen(tt.viewer); !slices.Equal(got, tt.want) {
+			t.Errorf("%s sees %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
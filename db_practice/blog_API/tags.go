@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const maxTagLength = 50
+
+// Tag is exchanged as a bare name in JSON, so posts carry "tags": ["go", "grpc"].
+type Tag struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"uniqueIndex;not null"`
+}
+
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.Name)
+}
+
+type tagCount struct {
+	Name      string `json:"name"`
+	PostCount int64  `json:"post_count"`
+}
+
+func normalizeTagName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// normalizeTags cleans up and de-duplicates the tag names sent by a client.
+func normalizeTags(tags []Tag) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		name := normalizeTagName(t.Name)
+		if name == "" {
+			return nil, &FieldError{Field: "tags", Code: "required", Message: "cannot contain empty names"}
+		}
+		if len(name) > maxTagLength {
+			return nil, &FieldError{Field: "tags", Code: "max", Message: "cannot contain names longer than 50 characters"}
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// resolveTags loads the named tags, creating the ones that don't exist yet.
+func resolveTags(tx *gorm.DB, names []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tag := Tag{Name: name}
+		if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func tagFilter(q *gorm.DB, names []string, matchAll bool) *gorm.DB {
+	sub := q.Session(&gorm.Session{NewDB: true}).
+		Table("post_tags").
+		Select("post_tags.post_id").
+		Joins("JOIN tags ON tags.id = post_tags.tag_id").
+		Where("tags.name IN ?", names)
+	if matchAll {
+		sub = sub.Group("post_tags.post_id").Having("COUNT(DISTINCT tags.id) = ?", len(names))
+	}
+	return q.Where("posts.id IN (?)", sub)
+}
+
+func (h *Handler) getAllTags(c echo.Context) error {
+	tags := []tagCount{}
+	err := h.DB.Table("tags").
+		Select("tags.name, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL AND posts.status = ?", StatusPublished).
+		Group("tags.id").
+		Order("post_count DESC, tags.name").
+		Scan(&tags).Error
+	if err != nil {
+		c.Logger().Errorf("Database error fetching tags: %v", err)
+		return dbError(err, "Failed to fetch tags")
+	}
+	return c.JSON(http.StatusOK, tags)
+}
+
+func (h *Handler) getPostsByTag(c echo.Context) error {
+	name := normalizeTagName(c.Param("name"))
+
+	var tag Tag
+	if err := h.DB.Where("name = ?", name).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Tag not found")
+		}
+		c.Logger().Errorf("Database error fetching tag %q: %v", name, err)
+		return dbError(err, "Failed to fetch tag")
+	}
+
+	params, err := parsePostListParams(c)
+	if errors.Is(err, errLoginRequired) {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	params.Tags, params.MatchAllTags = []string{tag.Name}, false
+
+	posts, err := params.paginate(params.applyFilters(h.DB.Model(&Post{}).Preload("Tags")))
+	if err != nil {
+		c.Logger().Errorf("Database error fetching posts for tag %q: %v", name, err)
+		return dbError(err, "Failed to fetch posts")
+	}
+	return c.JSON(http.StatusOK, posts)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const trashPurgeInterval = time.Hour
+
+// findTrashedPost loads a soft-deleted post for a caller who may modify it.
+// The error is the response to send when the post isn't in the trash or
+// the caller may not modify it.
+func (h *Handler) findTrashedPost(c echo.Context) (*Post, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid post ID format")
+	}
+
+	post := new(Post)
+	if err := h.DB.Unscoped().Where("deleted_at IS NOT NULL").First(post, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Post not found in trash")
+		}
+		c.Logger().Errorf("Database error fetching trashed post %d: %v", id, err)
+		return nil, dbError(err, "Failed to fetch trashed post")
+	}
+
+	if err := authorizeOwned(currentUser(c), post.AuthorID, PermDeleteOwnPosts, PermDeleteAnyPost); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// purgePosts permanently removes posts and everything that hangs off them.
+func purgePosts(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM post_tags WHERE post_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("post_id IN ?", ids).Delete(&Comment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("post_id IN ?", ids).Delete(&PostRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("post_id IN ?", ids).Delete(&PostSlug{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&Post{}, ids).Error
+}
+
+// purgeTrash hard-deletes posts and comments that have been in the trash since before cutoff.
+func purgeTrash(db *gorm.DB, cutoff time.Time) (int, error) {
+	var ids []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&Post{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if err := purgePosts(tx, ids); err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(&Comment{}).Error
+	})
+	return len(ids), err
+}
+
+// runTrashPurger empties old trash every hour until ctx is done. A zero
+// retention keeps trash forever.
+func (h *Handler) runTrashPurger(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := purgeTrash(h.DB.WithContext(ctx), time.Now().Add(-retention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d posts from the trash", n)
+		}
+		if _, err := h.removeOrphanedAttachments(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to remove orphaned attachments: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handler) getTrashedPosts(c echo.Context) error {
+	user := currentUser(c)
+	q := h.DB.Unscoped().Where("deleted_at IS NOT NULL")
+	if !can(user, PermDeleteAnyPost) {
+		q = q.Where("author_id = ?", user.ID)
+	}
+
+	posts := []Post{}
+	if err := q.Preload("Tags").Order("deleted_at DESC").Find(&posts).Error; err != nil {
+		c.Logger().Errorf("Database error fetching trashed posts: %v", err)
+		return dbError(err, "Failed to fetch trashed posts")
+	}
+	return c.JSON(http.StatusOK, posts)
+}
+
+// restorePost brings a post back along with the comments that were deleted with it.
+func (h *Handler) restorePost(c echo.Context) error {
+	post, err := h.findTrashedPost(c)
+	if post == nil {
+		return err
+	}
+
+	deletedAt := post.DeletedAt.Time
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(post).Updates(map[string]any{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&Comment{}).
+			Where("post_id = ? AND deleted_at = ?", post.ID, deletedAt).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		post.DeletedAt = gorm.DeletedAt{}
+		post.Version++
+		return enqueueEvent(tx, EventPostUpdated, "", post)
+	})
+	if err != nil {
+		c.Logger().Errorf("Database error restoring post %d: %v", post.ID, err)
+		return dbError(err, "Failed to restore post")
+	}
+
+	return c.JSON(http.StatusOK, post)
+}
+
+func (h *Handler) purgePost(c echo.Context) error {
+	post, err := h.findTrashedPost(c)
+	if post == nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		return purgePosts(tx, []uint{post.ID})
+	})
+	if err != nil {
+		c.Logger().Errorf("Database error purging post %d: %v", post.ID, err)
+		return dbError(err, "Failed to purge post")
+	}
+	if _, err := h.removeOrphanedAttachments(c.Request().Context()); err != nil {
+		c.Logger().Errorf("Failed to remove attachments of purged post %d: %v", post.ID, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
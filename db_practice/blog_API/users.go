@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var errLastAdmin = errors.New("last admin")
+
+type roleInput struct {
+	Role string `json:"role" validate:"required,oneof=admin editor author reader"`
+}
+
+// roleInfo is an entry of the permission matrix served by getRoles.
+type roleInfo struct {
+	Role        string       `json:"role"`
+	Permissions []Permission `json:"permissions"`
+}
+
+func (h *Handler) getUsers(c echo.Context) error {
+	users := []User{}
+	if err := h.DB.Order("id").Find(&users).Error; err != nil {
+		c.Logger().Errorf("Database error fetching users: %v", err)
+		return dbError(err, "Failed to fetch users")
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+func (h *Handler) getRoles(c echo.Context) error {
+	matrix := make([]roleInfo, 0, len(roles))
+	for _, role := range roles {
+		matrix = append(matrix, roleInfo{Role: role, Permissions: rolePermissions[role]})
+	}
+	return c.JSON(http.StatusOK, matrix)
+}
+
+// updateUserRole assigns a role. It applies from the user's next request,
+// tokens they already hold included. The last admin can't be demoted, so the
+// blog always keeps somebody who can assign roles.
+func (h *Handler) updateUserRole(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID format")
+	}
+
+	var input roleInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+	if err := validate.Struct(&input); err != nil {
+		return err
+	}
+
+	var user User
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if user.Role == RoleAdmin && input.Role != RoleAdmin {
+			var admins int64
+			if err := tx.Model(&User{}).Where("role = ?", RoleAdmin).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return errLastAdmin
+			}
+		}
+		user.Role = input.Role
+		return tx.Model(&user).Update("role", user.Role).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	case errors.Is(err, errLastAdmin):
+		return echo.NewHTTPError(http.StatusConflict, "Cannot demote the last admin")
+	case err != nil:
+		c.Logger().Errorf("Database error updating role of user %d: %v", id, err)
+		return dbError(err, "Failed to update role")
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	mathrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	EventPostCreated   = "post.created"
+	EventPostUpdated   = "post.updated"
+	EventPostPublished = "post.published"
+	EventPostDeleted   = "post.deleted"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+)
+
+const (
+	outboxBatchSize      = 100
+	deliveryBatchSize    = 50
+	maxDeliveryAttempts  = 8
+	deliveryBaseBackoff  = 30 * time.Second
+	deliveryMaxBackoff   = time.Hour
+	maxDeliveryErrorSize = 500
+)
+
+// Webhook is a subscription to post events. An empty Events list means all
+// events. The secret signs every delivery and is only shown when it is set.
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	URL       string    `json:"url" gorm:"not null"`
+	Events    []string  `json:"events" gorm:"serializer:json"`
+	Secret    string    `json:"secret,omitempty" gorm:"not null"`
+	Active    bool      `json:"active" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (w *Webhook) wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// OutboxEvent is written in the same transaction as the post change it
+// describes, so an event is recorded if and only if the change committed.
+// The outbox dispatcher fans events out into deliveries and deletes them.
+type OutboxEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	EventID   string `gorm:"not null;uniqueIndex"`
+	Event     string `gorm:"not null"`
+	PostID    uint   `gorm:"index"`
+	Payload   string `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is one event sent to one webhook. Deliveries that still
+// fail after maxDeliveryAttempts are dead-lettered and only retried by hand.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"not null"`
+	Event          string     `json:"event" gorm:"not null"`
+	Payload        string     `json:"-" gorm:"not null"`
+	Status         string     `json:"status" gorm:"not null;index:idx_delivery_due,priority:1"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_delivery_due,priority:2"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// webhookPayload is the body of a delivery. PreviousStatus is the status
+// the post had before the change, empty when it didn't exist or was in the
+// trash.
+type webhookPayload struct {
+	ID             string    `json:"id"`
+	Event          string    `json:"event"`
+	OccurredAt     time.Time `json:"occurred_at"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Post           *Post     `json:"post"`
+}
+
+type webhookInput struct {
+	URL    string   `json:"url" validate:"required,http_url,max=2000"`
+	Events []string `json:"events" validate:"dive,oneof=post.created post.updated post.published post.deleted"`
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=200"`
+	Active *bool    `json:"active"`
+}
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	// A redirect is not a successful delivery, and following it would turn
+	// the POST into a GET.
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func enqueueEvent(tx *gorm.DB, event, previousStatus string, post *Post) error {
+	id, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(webhookPayload{ID: id, Event: event, OccurredAt: time.Now().UTC(), PreviousStatus: previousStatus, Post: post})
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEvent{EventID: id, Event: event, PostID: post.ID, Payload: string(payload)}).Error
+}
+
+// enqueuePostEvents records the events for a post that was created (before
+// is nil) or changed, including the moment it first goes live.
+func enqueuePostEvents(tx *gorm.DB, before, post *Post) error {
+	event, previous := EventPostCreated, ""
+	if before != nil {
+		event, previous = EventPostUpdated, before.Status
+	}
+	if err := enqueueEvent(tx, event, previous, post); err != nil {
+		return err
+	}
+	if post.Status == StatusPublished && previous != StatusPublished {
+		return enqueueEvent(tx, EventPostPublished, previous, post)
+	}
+	return nil
+}
+
+// signWebhook signs "timestamp.body" so a receiver can reject replays of old
+// deliveries as well as forged ones.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// dispatchOutbox turns outbox events into one pending delivery per
+// interested webhook, and publishes them on the post stream once that has
+// committed. It returns how many events it took, at most outboxBatchSize.
+func dispatchOutbox(db *gorm.DB, stream *PostStream) (int, error) {
+	var events []OutboxEvent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Order("id").Limit(outboxBatchSize).Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		var hooks []Webhook
+		if err := tx.Where("active = ?", true).Find(&hooks).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var deliveries []WebhookDelivery
+		ids := make([]uint, len(events))
+		for i, ev := range events {
+			ids[i] = ev.ID
+			for _, hook := range hooks {
+				if hook.wants(ev.Event) {
+					deliveries = append(deliveries, WebhookDelivery{
+						WebhookID:     hook.ID,
+						EventID:       ev.EventID,
+						Event:         ev.Event,
+						Payload:       ev.Payload,
+						Status:        DeliveryPending,
+						NextAttemptAt: now,
+					})
+				}
+			}
+		}
+		if len(deliveries) > 0 {
+			if err := tx.Create(&deliveries).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&OutboxEvent{}, ids).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	stream.publishOutbox(events)
+	return len(events), nil
+}
+
+// deliveryBackoff doubles the wait after every failed attempt, with some
+// jitter so that failing receivers don't get retries in lockstep.
+func deliveryBackoff(attempts int) time.Duration {
+	d := time.Duration(math.Min(float64(deliveryMaxBackoff), float64(deliveryBaseBackoff)*math.Pow(2, float64(attempts-1))))
+	return d + time.Duration(mathrand.Int64N(int64(d/10)+1))
+}
+
+func sendWebhook(ctx context.Context, hook *Webhook, delivery *WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", "blog-api-webhooks/1")
+	req.Header.Set("X-Blog-Event", delivery.Event)
+	req.Header.Set("X-Blog-Event-ID", delivery.EventID)
+	req.Header.Set("X-Blog-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Blog-Signature", signWebhook(hook.Secret, time.Now().Unix(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("receiver responded with " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliverDue sends the deliveries whose next attempt is due. Those of an
+// inactive webhook are left out of the batch, so they can't crowd out the
+// rest; they are sent once the webhook is enabled again.
+func deliverDue(ctx context.Context, db *gorm.DB) (int, error) {
+	var due []WebhookDelivery
+	err := db.Select("webhook_deliveries.*").
+		Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id AND webhooks.active = ?", true).
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?", DeliveryPending, time.Now()).
+		Order("webhook_deliveries.next_attempt_at").Limit(deliveryBatchSize).Find(&due).Error
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	hookIDs := make([]uint, 0, len(due))
+	for _, d := range due {
+		hookIDs = append(hookIDs, d.WebhookID)
+	}
+	var hooks []Webhook
+	if err := db.Where("id IN ?", hookIDs).Find(&hooks).Error; err != nil {
+		return 0, err
+	}
+	byID := make(map[uint]*Webhook, len(hooks))
+	for i := range hooks {
+		byID[hooks[i].ID] = &hooks[i]
+	}
+
+	sent := 0
+	for i := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		d := &due[i]
+		hook, ok := byID[d.WebhookID]
+		if !ok || !hook.Active {
+			continue
+		}
+
+		code, sendErr := sendWebhook(ctx, hook, d)
+		now := time.Now()
+		updates := map[string]any{
+			"attempts":         d.Attempts + 1,
+			"last_status_code": code,
+			"last_error":       "",
+		}
+		switch {
+		case sendErr == nil:
+			updates["status"] = DeliverySucceeded
+			updates["delivered_at"] = now
+			sent++
+		case d.Attempts+1 >= maxDeliveryAttempts:
+			updates["status"] = DeliveryDead
+		default:
+			updates["next_attempt_at"] = now.Add(deliveryBackoff(d.Attempts + 1))
+		}
+		if sendErr != nil {
+			msg := sendErr.Error()
+			if len(msg) > maxDeliveryErrorSize {
+				msg = msg[:maxDeliveryErrorSize]
+			}
+			updates["last_error"] = msg
+		}
+		if err := db.Model(d).Updates(updates).Error; err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// runOutboxDispatcher empties the outbox every interval, or as soon as a
+// write wakes it, until ctx is done. It never waits on a webhook receiver, so
+// the post stream stays current while deliveries are slow; it wakes
+// runWebhookWorker through deliver instead. A wake that comes in during a
+// pass stays buffered and starts the next one.
+func runOutboxDispatcher(ctx context.Context, db *gorm.DB, interval time.Duration, stream *PostStream, wake <-chan struct{}, deliver chan<- struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := dispatchOutbox(db.WithContext(ctx), stream)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Failed to dispatch webhook events: %v", err)
+				}
+				break
+			}
+			if n > 0 {
+				select {
+				case deliver <- struct{}{}:
+				default:
+				}
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// runWebhookWorker sends the due deliveries every interval, or sooner when
+// new ones were queued, until ctx is done.
+func runWebhookWorker(ctx context.Context, db *gorm.DB, interval time.Duration, wake <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := deliverDue(ctx, db.WithContext(ctx)); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to deliver webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+func (h *Handler) findWebhook(c echo.Context) (*Webhook, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID format")
+	}
+
+	var hook Webhook
+	if err := h.DB.First(&hook, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Webhook not found")
+		}
+		c.Logger().Errorf("Database error fetching webhook %d: %v", id, err)
+		return nil, dbError(err, "Failed to fetch webhook")
+	}
+	return &hook, nil
+}
+
+func (h *Handler) getWebhooks(c echo.Context) error {
+	var hooks []Webhook
+	if err := h.DB.Order("id").Find(&hooks).Error; err != nil {
+		c.Logger().Errorf("Database error fetching webhooks: %v", err)
+		return dbError(err, "Failed to fetch webhooks")
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return c.JSON(http.StatusOK, hooks)
+}
+
+func (h *Handler) getWebhook(c echo.Context) error {
+	hook, err := h.findWebhook(c)
+	if hook == nil {
+		return err
+	}
+	hook.Secret = ""
+	return c.JSON(http.StatusOK, hook)
+}
+
+func (h *Handler) createWebhook(c echo.Context) error {
+	var input webhookInput
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+	if err := validate.Struct(&input); err != nil {
+		return err
+	}
+	if input.Events == nil {
+		input.Events = []string{}
+	}
+
+	hook := &Webhook{URL: input.URL, Events: input.Events, Secret: input.Secret, Active: true}
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+	if hook.Secret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			c.Logger().Errorf("Error generating webhook secret: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create webhook")
+		}
+		hook.Secret = "whsec_" + secret
+	}
+
+	if err := h.DB.Create(hook).Error; err != nil {
+		c.Logger().Errorf("Database error creating webhook: %v", err)
+		return dbError(err, "Failed to create webhook")
+	}
+	return c.JSON(http.StatusCreated, hook)
+}
+
+func (h *Handler) updateWebhook(c echo.Context) error {
+	hook, err := h.findWebhook(c)
+	if hook == nil {
+		return err
+	}
+
+	input := webhookInput{URL: hook.URL, Events: hook.Events, Active: &hook.Active}
+	if err := c.Bind(&input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid JSON body")
+	}
+	if err := validate.Struct(&input); err != nil {
+		return err
+	}
+	// "events": null leaves the subscription as it is; [] subscribes to all
+	// events.
+	if input.Events == nil {
+		input.Events = hook.Events
+	}
+
+	fields := []string{"url", "events", "active"}
+	if input.Secret != "" {
+		fields = append(fields, "secret")
+	}
+	hook.URL, hook.Events, hook.Active, hook.Secret = input.URL, input.Events, input.Active != nil && *input.Active, input.Secret
+	if err := h.DB.Model(hook).Select(fields).Updates(hook).Error; err != nil {
+		c.Logger().Errorf("Database error updating webhook %d: %v", hook.ID, err)
+		return dbError(err, "Failed to update webhook")
+	}
+	return c.JSON(http.StatusOK, hook)
+}
+
+// deleteWebhook removes the webhook together with its delivery log,
+// including deliveries that are still pending.
+func (h *Handler) deleteWebhook(c echo.Context) error {
+	hook, err := h.findWebhook(c)
+	if hook == nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", hook.ID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(hook).Error
+	})
+	if err != nil {
+		c.Logger().Errorf("Database error deleting webhook %d: %v", hook.ID, err)
+		return dbError(err, "Failed to delete webhook")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getWebhookDeliveries is the delivery log of a webhook, newest first. Older
+// entries are paged through with ?before=<delivery id>.
+func (h *Handler) getWebhookDeliveries(c echo.Context) error {
+	hook, err := h.findWebhook(c)
+	if hook == nil {
+		return err
+	}
+
+	limit := defaultPageLimit
+	if s := c.QueryParam("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxPageLimit {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit, must be between 1 and "+strconv.Itoa(maxPageLimit))
+		}
+	}
+
+	q := h.DB.Where("webhook_id = ?", hook.ID)
+	if s := c.QueryParam("status"); s != "" {
+		if s != DeliveryPending && s != DeliverySucceeded && s != DeliveryDead {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid status, must be one of pending, succeeded, dead")
+		}
+		q = q.Where("status = ?", s)
+	}
+	if s := c.QueryParam("before"); s != "" {
+		before, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid before, must be a delivery ID")
+		}
+		q = q.Where("id < ?", before)
+	}
+
+	deliveries := make([]WebhookDelivery, 0)
+	if err := q.Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		c.Logger().Errorf("Database error fetching deliveries of webhook %d: %v", hook.ID, err)
+		return dbError(err, "Failed to fetch deliveries")
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// retryDelivery puts a dead-lettered delivery, or a pending one that has
+// failed before, back in the queue to be sent right away, typically after the
+// receiver has been fixed. Deliveries that succeeded are not sent again.
+func (h *Handler) retryDelivery(c echo.Context) error {
+	hook, err := h.findWebhook(c)
+	if hook == nil {
+		return err
+	}
+	deliveryID, err := strconv.ParseUint(c.Param("deliveryID"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid delivery ID format")
+	}
+
+	var delivery WebhookDelivery
+	if err := h.DB.Where("webhook_id = ?", hook.ID).First(&delivery, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Delivery not found")
+		}
+		c.Logger().Errorf("Database error fetching delivery %d: %v", deliveryID, err)
+		return dbError(err, "Failed to fetch delivery")
+	}
+
+	if delivery.Status == DeliverySucceeded {
+		return echo.NewHTTPError(http.StatusConflict, "Delivery already succeeded")
+	}
+	if delivery.Status == DeliveryPending && delivery.Attempts == 0 {
+		return echo.NewHTTPError(http.StatusConflict, "Delivery has not been attempted yet")
+	}
+
+	delivery.Status, delivery.Attempts, delivery.NextAttemptAt = DeliveryPending, 0, time.Now()
+	err = h.DB.Model(&delivery).Updates(map[string]any{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}).Error
+	if err != nil {
+		c.Logger().Errorf("Database error retrying delivery %d: %v", deliveryID, err)
+		return dbError(err, "Failed to retry delivery")
+	}
+	return c.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// webhookReceiver records the deliveries it gets and answers them with
+// status.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.requests)
+}
+
+// queueEvent creates a published post and moves its events into deliveries.
+func queueEvent(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	post := &Post{Title: "Hooked", Content: "Body", Status: StatusPublished, Slug: "hooked-" + strconv.FormatInt(time.Now().UnixNano(), 36)}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(post).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, EventPostPublished, "", post)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dispatchOutbox(db, NewPostStream(0)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deliveriesOf(t *testing.T, db *gorm.DB, hook *Webhook) []WebhookDelivery {
+	t.Helper()
+	var deliveries []WebhookDelivery
+	if err := db.Where("webhook_id = ?", hook.ID).Order("id").Find(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	db := newTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	hook := &Webhook{URL: receiver.URL, Events: []string{EventPostPublished}, Secret: "whsec_test_secret_value", Active: true}
+	if err := db.Create(hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	queueEvent(t, db)
+
+	sent, err := deliverDue(context.Background(), db)
+	if err != nil || sent != 1 {
+		t.Fatalf("deliverDue = %d, %v, want 1 sent", sent, err)
+	}
+	got := receiver.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	req := got[0]
+	if req.header.Get("X-Blog-Event") != EventPostPublished || req.header.Get("X-Blog-Event-ID") == "" {
+		t.Errorf("event headers = %v", req.header)
+	}
+
+	signature := req.header.Get("X-Blog-Signature")
+	ts, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		t.Fatalf("signature %q has no timestamp", signature)
+	}
+	if want := signWebhook(hook.Secret, timestamp, req.body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+	if signWebhook("another secret", timestamp, req.body) == signature {
+		t.Error("signature doesn't depend on the secret")
+	}
+
+	d := deliveriesOf(t, db, hook)[0]
+	if d.Status != DeliverySucceeded || d.Attempts != 1 || d.LastStatusCode != http.StatusNoContent || d.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want succeeded on the first attempt", d)
+	}
+}
+
+func TestWebhookDeliveryRetriesThenDeadLetters(t *testing.T) {
+	db := newTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	hook := &Webhook{URL: receiver.URL, Secret: "whsec_test_secret_value", Active: true}
+	if err := db.Create(hook).Error; err != nil {
+		t.Fatal(err)
+	}
+	queueEvent(t, db)
+
+	start := time.Now()
+	if _, err := deliverDue(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	d := deliveriesOf(t, db, hook)[0]
+	if d.Status != DeliveryPending || d.Attempts != 1 || d.LastStatusCode != http.StatusInternalServerError || d.LastError == "" {
+		t.Fatalf("delivery after a failure = %+v, want pending with the error", d)
+	}
+	if wait := d.NextAttemptAt.Sub(start); wait < deliveryBaseBackoff {
+		t.Errorf("next attempt in %v, want at least %v", wait, deliveryBaseBackoff)
+	}
+
+	// Not due yet, so nothing is sent.
+	if _, err := deliverDue(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(receiver.received()); n != 1 {
+		t.Fatalf("receiver got %d requests before the backoff ran out, want 1", n)
+	}
+
+	// The last allowed attempt fails too.
+	err := db.Model(&d).Updates(map[string]any{"attempts": maxDeliveryAttempts - 1, "next_attempt_at": time.Now()}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deliverDue(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	d = deliveriesOf(t, db, hook)[0]
+	if d.Status != DeliveryDead || d.Attempts != maxDeliveryAttempts {
+		t.Errorf("delivery after %d failures = %+v, want dead", maxDeliveryAttempts, d)
+	}
+	if n := len(receiver.received()); n != 2 {
+		t.Errorf("receiver got %d requests, want 2", n)
+	}
+}
+
+func TestDeliveryBackoff(t *testing.T) {
+	for attempts := 1; attempts <= maxDeliveryAttempts+5; attempts++ {
+		base := min(deliveryMaxBackoff, deliveryBaseBackoff<<(attempts-1))
+		if d := deliveryBackoff(attempts); d < base || d > base+base/10 {
+			t.Errorf("deliveryBackoff(%d) = %v, want within 10%% above %v", attempts, d, base)
+		}
+	}
+}
+
+func TestInactiveWebhookDoesNotBlockDeliveries(t *testing.T) {
+	db := newTestDB(t)
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	inactive := &Webhook{URL: receiver.URL + "/inactive", Secret: "whsec_test_secret_value", Active: true}
+	active := &Webhook{URL: receiver.URL, Secret: "whsec_test_secret_value", Active: true}
+	if err := db.Create(inactive).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// A full batch of deliveries, all due before the one that should go out.
+	for range deliveryBatchSize {
+		queueEvent(t, db)
+	}
+	if err := db.Model(inactive).Update("active", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(active).Error; err != nil {
+		t.Fatal(err)
+	}
+	queueEvent(t, db)
+
+	sent, err := deliverDue(context.Background(), db)
+	if err != nil || sent != 1 {
+		t.Fatalf("deliverDue = %d, %v, want 1 sent", sent, err)
+	}
+	if got := deliveriesOf(t, db, active); got[0].Status != DeliverySucceeded {
+		t.Errorf("delivery of the active webhook = %+v", got[0])
+	}
+	for _, d := range deliveriesOf(t, db, inactive) {
+		if d.Status != DeliveryPending || d.Attempts != 0 {
+			t.Fatalf("delivery of the inactive webhook = %+v, want untouched", d)
+		}
+	}
+}
+
+func TestWebhookAPI(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.login(t, "root", RoleAdmin)
+
+	rec := s.do(http.MethodPost, "/webhooks", admin, map[string]any{"url": "https://hooks.example/in", "events": []string{EventPostPublished}})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /webhooks = %d %s", rec.Code, rec.Body)
+	}
+	hook := decodeJSON[Webhook](t, rec)
+	path := fmt.Sprintf("/webhooks/%d", hook.ID)
+
+	for _, tc := range []struct {
+		body string
+		want []string
+	}{
+		{`{"events": null}`, []string{EventPostPublished}},
+		{`{"url": "https://hooks.example/moved"}`, []string{EventPostPublished}},
+		{`{"events": []}`, []string{}},
+	} {
+		rec := s.do(http.MethodPut, path, admin, tc.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s = %d %s", tc.body, rec.Code, rec.Body)
+		}
+		var stored Webhook
+		if err := s.DB.First(&stored, hook.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(stored.Events, tc.want) {
+			t.Errorf("events after PUT %s = %v, want %v", tc.body, stored.Events, tc.want)
+		}
+	}
+
+	deliveries := []WebhookDelivery{
+		{WebhookID: hook.ID, EventID: "succeeded", Event: EventPostCreated, Payload: "{}", Status: DeliverySucceeded, Attempts: 1},
+		{WebhookID: hook.ID, EventID: "new", Event: EventPostCreated, Payload: "{}", Status: DeliveryPending},
+		{WebhookID: hook.ID, EventID: "failing", Event: EventPostCreated, Payload: "{}", Status: DeliveryPending, Attempts: 3, NextAttemptAt: time.Now().Add(time.Hour)},
+		{WebhookID: hook.ID, EventID: "dead", Event: EventPostCreated, Payload: "{}", Status: DeliveryDead, Attempts: maxDeliveryAttempts},
+	}
+	if err := s.DB.Create(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{http.StatusConflict, http.StatusConflict, http.StatusAccepted, http.StatusAccepted} {
+		d := deliveries[i]
+		rec := s.do(http.MethodPost, fmt.Sprintf("%s/deliveries/%d/retry", path, d.ID), admin, nil)
+		if rec.Code != want {
+			t.Errorf("retry of the %s delivery = %d, want %d", d.EventID, rec.Code, want)
+			continue
+		}
+		if want == http.StatusAccepted {
+			if got := decodeJSON[WebhookDelivery](t, rec); got.Status != DeliveryPending || got.Attempts != 0 || got.NextAttemptAt.After(time.Now()) {
+				t.Errorf("retried %s delivery = %+v, want pending and due", d.EventID, got)
+			}
+		}
+	}
+
+	if rec := s.do(http.MethodDelete, path, admin, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", rec.Code)
+	}
+	if left := deliveriesOf(t, s.DB, &hook); len(left) != 0 {
+		t.Errorf("%d deliveries left after deleting the webhook, want the log removed", len(left))
+	}
+}